@@ -0,0 +1,68 @@
+package bus
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// SubscribeChan subscribes to b and returns a channel that receives the
+// messages of b. The channel buffers up to bufSize messages, once it is full
+// delivery blocks like a slow Subscriber would. When ctx ends, the channel
+// is unsubscribed and closed.
+func SubscribeChan[E any](ctx context.Context, b Bus[E], bufSize int) <-chan E {
+	c := make(chan E, max(bufSize, 0))
+	mtx := &sync.RWMutex{} // guards closing c against concurrent sends
+	closed := false
+	unsubscribe := b.Subscribe(func(msg E) {
+		mtx.RLock()
+		defer mtx.RUnlock()
+		if closed {
+			return
+		}
+		select {
+		case c <- msg:
+		case <-ctx.Done():
+		}
+	})
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+		mtx.Lock()
+		defer mtx.Unlock()
+		closed = true
+		close(c)
+	}()
+	return c
+}
+
+// SubscribeSeq returns an iterator over the messages of b. Every iteration
+// subscribes to b when it starts and unsubscribes when the loop is left or
+// ctx ends. Publishing blocks until the loop takes the message.
+func SubscribeSeq[E any](ctx context.Context, b Bus[E]) iter.Seq[E] {
+	return func(yield func(E) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		for msg := range SubscribeChan(ctx, b, 0) {
+			if !yield(msg) {
+				return
+			}
+		}
+	}
+}
+
+// PublishFrom publishes all messages received from c on b until c is closed
+// or ctx ends. Returns ctx.Err() if ctx ended and nil otherwise.
+func PublishFrom[E any](ctx context.Context, b Bus[E], c <-chan E) error {
+	for {
+		select {
+		case msg, ok := <-c:
+			if !ok {
+				return nil
+			}
+			b.Publish(msg)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
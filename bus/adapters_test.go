@@ -0,0 +1,109 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestSubscribeChan(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	defer func() { _ = b.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := SubscribeChan[int](ctx, b, 10)
+	for i := 0; i < 3; i++ {
+		b.Publish(i)
+	}
+	for i := 0; i < 3; i++ {
+		expectMsg(t, c, i)
+	}
+	cancel()
+	select {
+	case _, ok := <-c:
+		if ok {
+			t.Fatal("expected no more messages")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected channel to be closed once the context ended")
+	}
+	b.Publish(3) // must not panic or block
+}
+
+func TestSubscribeChanDoesNotBlockPublisherAfterCancel(t *testing.T) {
+	b := NewBus[int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	_ = SubscribeChan[int](ctx, b, 0) // nobody reads
+	done := make(chan struct{})
+	go func() {
+		b.Publish(1)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publisher is still blocked after the context ended")
+	}
+}
+
+func TestSubscribeSeq(t *testing.T) {
+	b := NewBus[int]()
+	ctx := context.Background()
+	received := make(chan []int)
+	go func() {
+		var msgs []int
+		for msg := range SubscribeSeq[int](ctx, b) {
+			msgs = append(msgs, msg)
+			if len(msgs) == 3 {
+				break
+			}
+		}
+		received <- msgs
+	}()
+	for i := 0; len(*b.(*busImpl[int]).subs.Load()) == 0; i++ {
+		if i > 100 {
+			t.Fatal("iterator did not subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		b.Publish(i)
+	}
+	if msgs := <-received; fmt.Sprint(msgs) != "[0 1 2]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+	for i := 0; len(*b.(*busImpl[int]).subs.Load()) != 0; i++ {
+		if i > 100 {
+			t.Fatal("iterator did not unsubscribe after the loop was left")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPublishFrom(t *testing.T) {
+	b := NewBus[int]()
+	var msgs []int
+	b.Subscribe(func(msg int) { msgs = append(msgs, msg) })
+	c := make(chan int, 3)
+	c <- 1
+	c <- 2
+	close(c)
+	if err := PublishFrom(context.Background(), b, c); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(msgs) != "[1 2]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := PublishFrom(ctx, b, make(chan int)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -1,9 +1,16 @@
 package bus
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrClosed is returned by operations on a bus that has been closed.
+var ErrClosed = errors.New("bus is closed")
+
 // A Subscriber is called with messages that are published on the Bus.
 type Subscriber[E any] func(msg E)
 
@@ -21,22 +28,12 @@ type Bus[E any] interface {
 	Subscribe(sub Subscriber[E]) (unsubscribe func())
 }
 
-var (
-	mtx    = &sync.Mutex{}
-	busses = map[string]Bus[any]{}
-)
-
 // GetNamedBus - Provides thread-safe access to a Bus singleton with a given
-// name. Repeated calls with the same name always return the same Bus.
+// name. Repeated calls with the same name always return the same Bus. Panics
+// if the name was registered with a different message type, see
+// GetNamedTypedBus.
 func GetNamedBus(name string) Bus[any] {
-	mtx.Lock()
-	defer mtx.Unlock()
-	if b, ok := busses[name]; ok {
-		return b
-	}
-	b := NewBus[any]()
-	busses[name] = b
-	return b
+	return MustGetNamedTypedBus[any](name)
 }
 
 var (
@@ -53,54 +50,159 @@ func GetBus() Bus[any] {
 }
 
 type busImpl[E any] struct {
-	subMtx *sync.RWMutex
-	subs   []*subWithId[E]
+	subMtx *sync.Mutex                     // serializes writers of subs
+	subs   atomic.Pointer[[]*subWithId[E]] // immutable snapshot, replaced on every change
 	seq    int64
+	opts   options[E]
+
+	published atomic.Uint64
+	retired   atomic.Uint64 // messages delivered to Subscribers that unsubscribed
 }
 
 // NewBus creates a simple Bus. No go-routines are employed by this Bus.
-// Callers of Publish will directly invoke on all Subscribers.
-func NewBus[E any]() Bus[E] {
+// Callers of Publish will directly invoke on all Subscribers. Publish does
+// not take any locks, so Subscribers may subscribe and unsubscribe from
+// within their callback. A panicking Subscriber does not affect the caller
+// of Publish or other Subscribers, see WithPanicHandler and WithMaxPanics.
+func NewBus[E any](opts ...BusOption[E]) Bus[E] {
+	return newBus(newOptions(opts, BusOption[E].applyBus))
+}
+
+func newBus[E any](o options[E]) *busImpl[E] {
 	b := &busImpl[E]{
-		subMtx: &sync.RWMutex{},
-		subs:   []*subWithId[E]{},
+		subMtx: &sync.Mutex{},
 		seq:    0,
+		opts:   o,
 	}
+	b.subs.Store(&[]*subWithId[E]{})
 	return b
 }
 
 func (b *busImpl[E]) Publish(msg E) {
-	b.subMtx.RLock()
-	defer b.subMtx.RUnlock()
-	for _, sub := range b.subs {
-		sub.sub(msg)
+	if len(b.opts.publishInterceptors) > 0 {
+		b.opts.interceptPublish(0, msg, b.publish)
+		return
+	}
+	b.publish(msg)
+}
+
+func (b *busImpl[E]) publish(msg E) {
+	b.publishTo(context.Background(), *b.subs.Load(), msg)
+}
+
+// PublishContext publishes msg like Publish and passes ctx on to
+// ContextSubscribers. It always succeeds, as no queue can fill up.
+func (b *busImpl[E]) PublishContext(ctx context.Context, msg E) error {
+	if len(b.opts.publishInterceptors) > 0 {
+		b.opts.interceptPublish(0, msg, func(msg E) {
+			b.publishTo(ctx, *b.subs.Load(), msg)
+		})
+		return nil
+	}
+	b.publishTo(ctx, *b.subs.Load(), msg)
+	return nil
+}
+
+// publishTo delivers msg to the given snapshot of subscribers.
+func (b *busImpl[E]) publishTo(ctx context.Context, subs []*subWithId[E], msg E) {
+	b.published.Add(1)
+	for _, sub := range subs {
+		if !sub.deliver(&b.opts, ctx, msg) && b.opts.exceedsMaxPanics(sub.panics.Add(1)) {
+			b.unsubscribeId(sub.id)()
+		}
 	}
 }
 
 func (b *busImpl[E]) Subscribe(sub Subscriber[E]) (unsubscribe func()) {
+	return b.unsubscribeId(b.subscribe(sub, nil, nil).id)
+}
+
+func (b *busImpl[E]) subscribeGated(sub Subscriber[E], ctxSub ContextSubscriber[E], admit func() bool) (unsubscribe func()) {
+	if admit == nil {
+		return b.unsubscribeId(b.subscribe(sub, ctxSub, nil).id)
+	}
+	return b.unsubscribeId(b.subscribe(sub, ctxSub, func(E) bool { return admit() }).id)
+}
+
+// subscribe adds a subscriber, see gatedSubscribable. admit, if set, is
+// called with every message and reports whether it is delivered.
+func (b *busImpl[E]) subscribe(sub Subscriber[E], ctxSub ContextSubscriber[E], admit func(msg E) bool) *subWithId[E] {
 	b.subMtx.Lock()
 	defer b.subMtx.Unlock()
 	b.seq++
-	s := &subWithId[E]{id: b.seq, sub: sub}
-	b.subs = append(b.subs, s)
-	return b.unsubscribeId(b.seq)
+	s := &subWithId[E]{
+		id:      b.seq,
+		sub:     sub,
+		ctxSub:  ctxSub,
+		admit:   admit,
+		latency: newLatencyRecorder(b.opts.latencyStats),
+	}
+	old := *b.subs.Load()
+	subs := make([]*subWithId[E], len(old), len(old)+1)
+	copy(subs, old)
+	subs = append(subs, s)
+	b.subs.Store(&subs)
+	return s
 }
 
 func (b *busImpl[E]) unsubscribeId(id int64) (unsubscribe func()) {
 	return func() {
 		b.subMtx.Lock()
 		defer b.subMtx.Unlock()
-		var subs []*subWithId[E]
-		for _, sub := range b.subs {
+		old := *b.subs.Load()
+		subs := make([]*subWithId[E], 0, len(old))
+		for _, sub := range old {
 			if sub.id != id {
 				subs = append(subs, sub)
+			} else {
+				b.retired.Add(sub.delivered.Load())
 			}
 		}
-		b.subs = subs
+		b.subs.Store(&subs)
 	}
 }
 
+func (b *busImpl[E]) Stats() Stats {
+	subs := *b.subs.Load()
+	stats := Stats{
+		Subscribers:   len(subs),
+		Published:     b.published.Load(),
+		Delivered:     b.retired.Load(),
+		Subscriptions: make([]SubscriberStats, len(subs)),
+	}
+	for i, sub := range subs {
+		stats.Subscriptions[i] = SubscriberStats{
+			Id:        sub.id,
+			Delivered: sub.delivered.Load(),
+			Panics:    sub.panics.Load(),
+			Latency:   sub.latency.snapshot(),
+		}
+		stats.Delivered += stats.Subscriptions[i].Delivered
+	}
+	return stats
+}
+
 type subWithId[E any] struct {
-	id  int64
-	sub Subscriber[E]
+	id      int64
+	sub     Subscriber[E]
+	ctxSub  ContextSubscriber[E] // replaces sub if set
+	admit   func(msg E) bool     // nil or reports whether msg is delivered, see gatedSubscribable
+	panics  atomic.Int64
+	latency *latencyRecorder // nil unless WithLatencyStats is set
+
+	delivered atomic.Uint64
+}
+
+// deliver delivers msg like options.deliver and measures the latency of s.
+func (s *subWithId[E]) deliver(o *options[E], ctx context.Context, msg E) bool {
+	if s.admit != nil && !s.admit(msg) {
+		return true
+	}
+	if s.latency == nil {
+		return o.deliverTo(s.id, s.sub, s.ctxSub, ctx, msg, &s.delivered)
+	}
+	start := time.Now()
+	ok := o.deliverTo(s.id, s.sub, s.ctxSub, ctx, msg, &s.delivered)
+	s.latency.observe(time.Since(start))
+	return ok
 }
@@ -2,6 +2,7 @@ package bus
 
 import (
 	"reflect"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -99,6 +100,111 @@ func TestBusReceiverShouldNotReceivePublishMessageAfterUnsubscribe(t *testing.T)
 	}
 }
 
+func TestBusSubscriberCanUnsubscribeItself(t *testing.T) {
+	b := NewBus[int]()
+	count := 0
+	var unsubscribe func()
+	unsubscribe = b.Subscribe(func(int) {
+		count++
+		unsubscribe() // used to deadlock while Publish held the read lock
+	})
+	done := make(chan struct{})
+	go func() {
+		b.Publish(1)
+		b.Publish(2)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("unsubscribing from within a subscriber deadlocked")
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 delivery, got %d", count)
+	}
+}
+
+func TestBusSubscribeFromSubscriberTakesEffectOnNextPublish(t *testing.T) {
+	b := NewBus[int]()
+	var outer, inner int
+	once := sync.Once{}
+	b.Subscribe(func(int) {
+		outer++
+		once.Do(func() {
+			b.Subscribe(func(int) { inner++ })
+		})
+	})
+	b.Publish(1) // inner subscriber is not part of this publish' snapshot
+	b.Publish(2)
+	if outer != 2 || inner != 1 {
+		t.Fatalf("expected outer=2 and inner=1, got outer=%d and inner=%d", outer, inner)
+	}
+}
+
+func TestBusConcurrentPublishAndSubscribe(t *testing.T) {
+	b := NewBus[int]()
+	var n atomic.Int64
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				b.Publish(j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				unsubscribe := b.Subscribe(func(int) { n.Add(1) })
+				unsubscribe()
+			}
+		}()
+	}
+	wg.Wait()
+	if subs := len(*b.(*busImpl[int]).subs.Load()); subs != 0 {
+		t.Fatalf("expected all subscribers to be removed, %d left", subs)
+	}
+}
+
+func TestBusPanickingSubscriberDoesNotAffectOthers(t *testing.T) {
+	var recovered []any
+	var ids []int64
+	b := NewBus[int](WithPanicHandler(func(msg int, subscriberId int64, r any, stack []byte) {
+		recovered = append(recovered, r)
+		ids = append(ids, subscriberId)
+		if len(stack) == 0 {
+			t.Error("expected a stack trace")
+		}
+	}))
+	count := 0
+	b.Subscribe(func(int) { panic("boom") })
+	b.Subscribe(func(int) { count++ })
+	b.Publish(1)
+	b.Publish(2)
+	if count != 2 {
+		t.Fatalf("expected 2 deliveries to the healthy subscriber, got %d", count)
+	}
+	if len(recovered) != 2 || recovered[0] != "boom" || ids[0] != 1 {
+		t.Fatalf("unexpected panic reports: %v (ids %v)", recovered, ids)
+	}
+}
+
+func TestBusMaxPanicsUnsubscribes(t *testing.T) {
+	b := NewBus[int](WithPanicHandler(func(int, int64, any, []byte) {}), WithMaxPanics[int](2))
+	calls := 0
+	b.Subscribe(func(int) {
+		calls++
+		panic("boom")
+	})
+	for i := 0; i < 5; i++ {
+		b.Publish(i)
+	}
+	if calls != 2 {
+		t.Fatalf("expected subscriber to be unsubscribed after 2 panics, was called %d times", calls)
+	}
+}
+
 /**
  * Benchmarks
  */
@@ -197,3 +303,48 @@ func BenchmarkBusPublishReference__1000_Subs(b *testing.B) {
 		bu.Publish(&simpleBenchObj)
 	}
 }
+
+func BenchmarkBusPublishPrimitiveParallel__1000_Subs(b *testing.B) {
+	bu := NewBus[int]()
+	for i := 0; i < 1000; i++ {
+		s := &busBenchSub[int]{0}
+		bu.Subscribe(s.HandleMessage)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			bu.Publish(i)
+		}
+	})
+}
+
+func BenchmarkBusPublishPrimitiveWithSubscribeChurn__1000_Subs(b *testing.B) {
+	bu := NewBus[int]()
+	for i := 0; i < 1000; i++ {
+		s := &busBenchSub[int]{0}
+		bu.Subscribe(s.HandleMessage)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() { // concurrently subscribe and unsubscribe while publishing
+		defer close(done)
+		s := &busBenchSub[int]{0}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				bu.Subscribe(s.HandleMessage)()
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bu.Publish(i)
+	}
+	b.StopTimer()
+	close(stop)
+	<-done
+}
@@ -0,0 +1,51 @@
+package bus
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// A Codec converts messages to bytes and back. Codecs are used wherever
+// messages leave the process' memory, e.g. by the DurableBus.
+type Codec[E any] interface {
+	Encode(msg E) ([]byte, error)
+	Decode(data []byte) (E, error)
+}
+
+type jsonCodec[E any] struct{}
+
+// JSONCodec returns a Codec that uses encoding/json.
+func JSONCodec[E any]() Codec[E] {
+	return jsonCodec[E]{}
+}
+
+func (jsonCodec[E]) Encode(msg E) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec[E]) Decode(data []byte) (msg E, err error) {
+	err = json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+type gobCodec[E any] struct{}
+
+// GobCodec returns a Codec that uses encoding/gob. Every message is encoded
+// on its own and therefore carries its own type information.
+func GobCodec[E any]() Codec[E] {
+	return gobCodec[E]{}
+}
+
+func (gobCodec[E]) Encode(msg E) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(&msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec[E]) Decode(data []byte) (msg E, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&msg)
+	return msg, err
+}
@@ -0,0 +1,63 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrQueueFull is returned by WorkerBus.PublishContext if the context ended
+// while waiting for space in the queue. The error also wraps the error of the
+// context.
+var ErrQueueFull = errors.New("bus queue is full")
+
+// A ContextSubscriber is called with messages that are published on the Bus
+// together with the context they were published with, see PublishContext.
+type ContextSubscriber[E any] func(ctx context.Context, msg E)
+
+// gatedSubscribable is implemented by the buses without options for their
+// Subscribers that pass contexts on to ContextSubscribers. The bus calls
+// ctxSub if set and sub otherwise, but only if admit, if set, returns true.
+// Messages that are not admitted are not counted as delivered.
+type gatedSubscribable[E any] interface {
+	subscribeGated(sub Subscriber[E], ctxSub ContextSubscriber[E], admit func() bool) (unsubscribe func())
+}
+
+// PublishContext publishes msg on b and passes ctx on to the
+// ContextSubscribers of b. A WorkerBus waits for queue space until ctx ends,
+// see WorkerBus.PublishContext. Other buses publish msg like Publish and
+// always return nil.
+func PublishContext[E any](ctx context.Context, b Bus[E], msg E) error {
+	if cb, ok := b.(interface {
+		PublishContext(ctx context.Context, msg E) error
+	}); ok {
+		return cb.PublishContext(ctx, msg)
+	}
+	b.Publish(msg)
+	return nil
+}
+
+// SubscribeWithContext subscribes sub to b and returns its Subscription. sub
+// is called with the context the message was published with, see
+// PublishContext. Buses that do not propagate contexts, and messages that
+// were published without one, pass context.Background(). Unlike
+// SubscribeContext, the Subscription is not bound to a context. The options
+// only apply if b is a WorkerBus.
+func SubscribeWithContext[E any](b Bus[E], sub ContextSubscriber[E], opts ...SubscribeOption[E]) Subscription {
+	if wb, ok := b.(*workerBusImpl[E]); ok {
+		return wb.subscribeContextWithOptions(sub, opts)
+	}
+	return newContextSubscription(b, sub)
+}
+
+// deliverTo delivers msg like deliver, to ctxSub together with ctx if ctxSub
+// is set and to sub otherwise. A nil ctx is passed on as context.Background().
+func (o *options[E]) deliverTo(subscriberId int64, sub Subscriber[E], ctxSub ContextSubscriber[E], ctx context.Context, msg E, delivered *atomic.Uint64) bool {
+	if ctxSub != nil {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		sub = func(msg E) { ctxSub(ctx, msg) }
+	}
+	return o.deliver(subscriberId, sub, msg, delivered)
+}
@@ -0,0 +1,101 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+/**
+ * Tests
+ */
+func TestPublishContextPropagatesContext(t *testing.T) {
+	for name, b := range map[string]Bus[int]{"Bus": NewBus[int](), "WorkerBus": NewWorkerBus[int](10)} {
+		t.Run(name, func(t *testing.T) {
+			values := make(chan any, 10)
+			s := SubscribeWithContext(b, func(ctx context.Context, msg int) { values <- ctx.Value(ctxKey{}) })
+			defer s.Unsubscribe()
+			ctx := context.WithValue(context.Background(), ctxKey{}, "request-1")
+			if err := PublishContext(ctx, b, 1); err != nil {
+				t.Fatal(err)
+			}
+			expectMsg[any](t, values, "request-1")
+			b.Publish(2)
+			expectMsg[any](t, values, nil)
+		})
+	}
+}
+
+func TestPublishContextDetachesCancellation(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	defer func() { _ = b.Close() }()
+	errs := make(chan error, 1)
+	SubscribeWithContext[int](b, func(ctx context.Context, msg int) { errs <- ctx.Err() })
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := b.PublishContext(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	expectMsg(t, errs, nil)
+}
+
+func TestPublishContextReturnsContextError(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	defer func() { _ = b.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.PublishContext(ctx, 1); !errors.Is(err, context.Canceled) || errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if stats := b.Stats(); stats.Published != 0 {
+		t.Fatalf("expected nothing to be published, got %d", stats.Published)
+	}
+}
+
+func TestPublishContextReturnsErrQueueFull(t *testing.T) {
+	b := NewWorkerBus[int](1)
+	defer func() { _ = b.Close() }()
+	release := make(chan struct{})
+	defer close(release)
+	blockedSubscriber(t, b, release)
+	b.Publish(0) // fills the queue of the Subscriber
+	b.Publish(1) // blocks the worker of the bus
+	b.Publish(2) // fills the queue of the bus
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := b.PublishContext(ctx, 3)
+	if !errors.Is(err, ErrQueueFull) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ErrQueueFull and context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestPublishContextReturnsErrClosed(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.PublishContext(context.Background(), 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestSubscribeWithContextFallsBack(t *testing.T) {
+	b := NewReplayBus[int](10, 0)
+	b.Publish(1)
+	values := make(chan any, 10)
+	s := SubscribeWithContext(b, func(ctx context.Context, msg int) { values <- ctx.Value(ctxKey{}) })
+	expectMsg[any](t, values, nil)
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request-1")
+	if err := PublishContext(ctx, b, 2); err != nil {
+		t.Fatal(err)
+	}
+	expectMsg[any](t, values, nil)
+	s.Unsubscribe()
+	b.Publish(3)
+	if len(values) != 0 {
+		t.Fatal("expected no messages after Unsubscribe")
+	}
+}
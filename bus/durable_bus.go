@@ -0,0 +1,273 @@
+package bus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const consumersDir = "consumers"
+
+// A DurableBus appends every published message to a segmented log on disk
+// before it is delivered. Subscriber(s) may start reading at any offset that
+// is still retained, so messages survive restarts and late Subscriber(s) can
+// catch up. Every Subscriber is served by its own go-routine that reads the
+// log in order.
+type DurableBus[E any] interface {
+	// Bus.Publish appends the message to the log, errors are logged. Bus.Subscribe
+	// only delivers messages that are published after subscribing.
+	Bus[E]
+
+	// Append publishes msg and returns the offset it was stored at.
+	Append(msg E) (offset uint64, err error)
+
+	// SubscribeFrom subscribes to all messages starting at the given offset.
+	// If the offset is no longer retained, delivery starts at the oldest
+	// retained message.
+	SubscribeFrom(offset uint64, sub Subscriber[E]) (unsubscribe func(), err error)
+
+	// SubscribeFromTime subscribes to all messages that were published at or
+	// after t.
+	SubscribeFromTime(t time.Time, sub Subscriber[E]) (unsubscribe func(), err error)
+
+	// SubscribeConsumer subscribes a named consumer. Its offset is persisted
+	// after every delivered message and delivery resumes from there on the
+	// next subscription, including after a restart. A new consumer starts at
+	// the oldest retained message. Only one Subscriber per name may be
+	// subscribed at a time.
+	SubscribeConsumer(name string, sub Subscriber[E]) (unsubscribe func(), err error)
+
+	// Compact deletes segments that exceed the retention limits, see
+	// WithRetention. If a compaction key was configured (see WithCompactionKey),
+	// all but the latest message per key are removed from the log, except
+	// for the segment that is currently written to.
+	Compact() error
+
+	// Close stops all Subscriber(s) and closes the log. Close must not be
+	// called from a Subscriber.
+	Close() error
+}
+
+type durableBusImpl[E any] struct {
+	dir       string
+	log       *durableLog
+	opts      options[E]
+	mtx       *sync.Mutex
+	subs      map[int64]*durableSub[E]
+	consumers map[string]bool
+	seq       int64
+	wg        *sync.WaitGroup
+	closed    bool
+}
+
+// OpenDurableBus opens the DurableBus stored in dir, creating it if it does
+// not exist. Messages are stored with the Codec set by WithCodec.
+func OpenDurableBus[E any](dir string, opts ...DurableBusOption[E]) (DurableBus[E], error) {
+	o := newOptions(opts, DurableBusOption[E].applyDurableBus)
+	l, err := openDurableLog(dir, o.segmentBytes, o.maxBytes, o.maxAge, o.syncWrites)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Join(dir, consumersDir), 0o755); err != nil {
+		_ = l.close()
+		return nil, err
+	}
+	return &durableBusImpl[E]{
+		dir:       dir,
+		log:       l,
+		opts:      o,
+		mtx:       &sync.Mutex{},
+		subs:      map[int64]*durableSub[E]{},
+		consumers: map[string]bool{},
+		wg:        &sync.WaitGroup{},
+	}, nil
+}
+
+func (b *durableBusImpl[E]) Publish(msg E) {
+	if _, err := b.Append(msg); err != nil {
+		log.Printf("bus: failed to append message: %v", err)
+	}
+}
+
+func (b *durableBusImpl[E]) Append(msg E) (offset uint64, err error) {
+	data, err := b.opts.codec.Encode(msg)
+	if err != nil {
+		return 0, err
+	}
+	return b.log.append(data)
+}
+
+func (b *durableBusImpl[E]) Subscribe(sub Subscriber[E]) (unsubscribe func()) {
+	unsubscribe, err := b.SubscribeFrom(b.log.nextOffset(), sub)
+	if err != nil {
+		return func() {}
+	}
+	return unsubscribe
+}
+
+func (b *durableBusImpl[E]) SubscribeFrom(offset uint64, sub Subscriber[E]) (unsubscribe func(), err error) {
+	return b.subscribe(offset, sub, "", nil)
+}
+
+func (b *durableBusImpl[E]) SubscribeFromTime(t time.Time, sub Subscriber[E]) (unsubscribe func(), err error) {
+	offset, err := b.log.offsetAt(t)
+	if err != nil {
+		return nil, err
+	}
+	return b.subscribe(offset, sub, "", nil)
+}
+
+func (b *durableBusImpl[E]) SubscribeConsumer(name string, sub Subscriber[E]) (unsubscribe func(), err error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid consumer name %q", name)
+	}
+	f, err := os.OpenFile(filepath.Join(b.dir, consumersDir, name), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	var offset uint64
+	buf := make([]byte, 8)
+	if n, _ := f.ReadAt(buf, 0); n == len(buf) {
+		offset = binary.BigEndian.Uint64(buf)
+	}
+	unsubscribe, err = b.subscribe(offset, sub, name, f)
+	if err != nil {
+		_ = f.Close()
+	}
+	return unsubscribe, err
+}
+
+func (b *durableBusImpl[E]) subscribe(offset uint64, sub Subscriber[E], name string, offsets *os.File) (unsubscribe func(), err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if name != "" {
+		if b.consumers[name] {
+			return nil, fmt.Errorf("consumer %q is already subscribed", name)
+		}
+		b.consumers[name] = true
+	}
+	b.seq++
+	s := &durableSub[E]{
+		id:      b.seq,
+		sub:     sub,
+		name:    name,
+		c:       cursor{next: offset},
+		stop:    make(chan struct{}),
+		offsets: offsets,
+	}
+	b.subs[s.id] = s
+	b.wg.Add(1)
+	go b.read(s)
+	return b.unsubscribeId(s.id), nil
+}
+
+func (b *durableBusImpl[E]) unsubscribeId(id int64) (unsubscribe func()) {
+	return func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		if s, ok := b.subs[id]; ok {
+			close(s.stop)
+			delete(b.subs, id)
+			delete(b.consumers, s.name)
+		}
+	}
+}
+
+// read delivers messages from the log to s until s is unsubscribed.
+func (b *durableBusImpl[E]) read(s *durableSub[E]) {
+	defer b.wg.Done()
+	if s.offsets != nil {
+		defer func() { _ = s.offsets.Close() }()
+	}
+	for {
+		rec, wait, err := b.log.read(&s.c)
+		if errors.Is(err, ErrClosed) {
+			return
+		} else if err != nil {
+			log.Printf("bus: stopped durable subscriber %d: %v", s.id, err)
+			b.unsubscribeId(s.id)()
+			return
+		}
+		if wait != nil {
+			select {
+			case <-wait:
+				continue
+			case <-s.stop:
+				return
+			}
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		if msg, err := b.opts.codec.Decode(rec.data); err != nil {
+			log.Printf("bus: skipped message %d that could not be decoded: %v", rec.offset, err)
+		} else if !b.opts.deliver(s.id, s.sub, msg, nil) {
+			s.panics++
+			if b.opts.exceedsMaxPanics(s.panics) {
+				b.unsubscribeId(s.id)()
+			}
+		}
+		if s.offsets != nil {
+			s.commit(rec.offset + 1)
+		}
+	}
+}
+
+func (b *durableBusImpl[E]) Compact() error {
+	b.log.retain()
+	if b.opts.compactionKey == nil {
+		return nil
+	}
+	return b.log.compact(func(data []byte) (string, error) {
+		msg, err := b.opts.codec.Decode(data)
+		if err != nil {
+			return "", err
+		}
+		return b.opts.compactionKey(msg), nil
+	})
+}
+
+func (b *durableBusImpl[E]) Close() error {
+	b.mtx.Lock()
+	if b.closed {
+		b.mtx.Unlock()
+		return nil
+	}
+	b.closed = true
+	for id, s := range b.subs {
+		close(s.stop)
+		delete(b.subs, id)
+	}
+	b.mtx.Unlock()
+	b.wg.Wait()
+	return b.log.close()
+}
+
+type durableSub[E any] struct {
+	id      int64
+	sub     Subscriber[E]
+	name    string // of the consumer, empty if not subscribed as a consumer
+	c       cursor
+	stop    chan struct{}
+	offsets *os.File // persisted offset of the consumer
+	panics  int64
+}
+
+func (s *durableSub[E]) commit(offset uint64) {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, offset)
+	if _, err := s.offsets.WriteAt(buf, 0); err != nil {
+		log.Printf("bus: failed to commit offset of consumer %q: %v", s.name, err)
+	}
+}
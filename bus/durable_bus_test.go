@@ -0,0 +1,287 @@
+package bus
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+type durableTestMsg struct {
+	Key   string
+	Value int
+}
+
+func openDurableTestBus(t *testing.T, dir string, opts ...DurableBusOption[durableTestMsg]) DurableBus[durableTestMsg] {
+	b, err := OpenDurableBus(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	return b
+}
+
+func receiveDurable(t *testing.T, c chan durableTestMsg, n int) (msgs []durableTestMsg) {
+	t.Helper()
+	for len(msgs) < n {
+		select {
+		case msg := <-c:
+			msgs = append(msgs, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d of %d messages: %v", len(msgs), n, msgs)
+		}
+	}
+	select {
+	case msg := <-c:
+		t.Fatalf("received unexpected message %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+	return msgs
+}
+
+func TestDurableBusDeliversPublishedMessages(t *testing.T) {
+	b := openDurableTestBus(t, t.TempDir())
+	b.Publish(durableTestMsg{"a", 0}) // before subscribing, not delivered
+	c := make(chan durableTestMsg, 100)
+	b.Subscribe(func(msg durableTestMsg) { c <- msg })
+	for i := 1; i <= 3; i++ {
+		b.Publish(durableTestMsg{"a", i})
+	}
+	msgs := receiveDurable(t, c, 3)
+	if fmt.Sprint(msgs) != "[{a 1} {a 2} {a 3}]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestDurableBusReplaysFromOffsetAfterReopen(t *testing.T) {
+	for name, codec := range map[string]Codec[durableTestMsg]{
+		"gob":  GobCodec[durableTestMsg](),
+		"json": JSONCodec[durableTestMsg](),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			b := openDurableTestBus(t, dir, WithCodec(codec), WithSegmentSize[durableTestMsg](100))
+			for i := 0; i < 10; i++ {
+				if offset, err := b.Append(durableTestMsg{"a", i}); err != nil {
+					t.Fatal(err)
+				} else if offset != uint64(i) {
+					t.Fatalf("expected offset %d, got %d", i, offset)
+				}
+			}
+			if err := b.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			b = openDurableTestBus(t, dir, WithCodec(codec), WithSegmentSize[durableTestMsg](100))
+			c := make(chan durableTestMsg, 100)
+			if _, err := b.SubscribeFrom(7, func(msg durableTestMsg) { c <- msg }); err != nil {
+				t.Fatal(err)
+			}
+			if offset, err := b.Append(durableTestMsg{"a", 10}); err != nil || offset != 10 {
+				t.Fatalf("expected offset 10, got %d (%v)", offset, err)
+			}
+			msgs := receiveDurable(t, c, 4)
+			if fmt.Sprint(msgs) != "[{a 7} {a 8} {a 9} {a 10}]" {
+				t.Fatalf("unexpected messages: %v", msgs)
+			}
+		})
+	}
+}
+
+func TestDurableBusSubscribeFromTime(t *testing.T) {
+	b := openDurableTestBus(t, t.TempDir())
+	for i := 0; i < 3; i++ {
+		b.Publish(durableTestMsg{"old", i})
+	}
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	for i := 0; i < 2; i++ {
+		b.Publish(durableTestMsg{"new", i})
+	}
+	c := make(chan durableTestMsg, 100)
+	if _, err := b.SubscribeFromTime(since, func(msg durableTestMsg) { c <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	msgs := receiveDurable(t, c, 2)
+	if fmt.Sprint(msgs) != "[{new 0} {new 1}]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestDurableBusConsumerResumesAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	b := openDurableTestBus(t, dir)
+	c := make(chan durableTestMsg, 100)
+	unsubscribe, err := b.SubscribeConsumer("worker", func(msg durableTestMsg) { c <- msg })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.SubscribeConsumer("worker", func(durableTestMsg) {}); err == nil {
+		t.Fatal("expected error when subscribing the same consumer twice")
+	}
+	for i := 0; i < 3; i++ {
+		b.Publish(durableTestMsg{"a", i})
+	}
+	receiveDurable(t, c, 3)
+	unsubscribe()
+	for i := 3; i < 5; i++ {
+		b.Publish(durableTestMsg{"a", i})
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b = openDurableTestBus(t, dir)
+	if _, err = b.SubscribeConsumer("worker", func(msg durableTestMsg) { c <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	msgs := receiveDurable(t, c, 2)
+	if fmt.Sprint(msgs) != "[{a 3} {a 4}]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestDurableBusInvalidConsumerName(t *testing.T) {
+	b := openDurableTestBus(t, t.TempDir())
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`} {
+		if _, err := b.SubscribeConsumer(name, func(durableTestMsg) {}); err == nil {
+			t.Errorf("expected error for consumer name %q", name)
+		}
+	}
+}
+
+func TestDurableBusRetentionBySize(t *testing.T) {
+	dir := t.TempDir()
+	b := openDurableTestBus(t, dir, WithCodec(JSONCodec[durableTestMsg]()),
+		WithSegmentSize[durableTestMsg](200), WithRetention[durableTestMsg](400, 0))
+	for i := 0; i < 100; i++ {
+		b.Publish(durableTestMsg{"a", i})
+	}
+	var total int64
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	for _, segment := range segments {
+		info, err := os.Stat(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += info.Size()
+	}
+	if total > 400+200 {
+		t.Fatalf("expected retention to limit the log to about 400 bytes, got %d bytes", total)
+	}
+
+	c := make(chan durableTestMsg, 100)
+	if _, err := b.SubscribeFrom(0, func(msg durableTestMsg) { c <- msg }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-c:
+		if msg.Value == 0 {
+			t.Fatal("expected the oldest messages to be deleted")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected delivery to start at the oldest retained message")
+	}
+}
+
+func TestDurableBusRetentionByAge(t *testing.T) {
+	dir := t.TempDir()
+	b := openDurableTestBus(t, dir, WithSegmentSize[durableTestMsg](1), WithRetention[durableTestMsg](0, 10*time.Millisecond))
+	for i := 0; i < 5; i++ {
+		b.Publish(durableTestMsg{"a", i})
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := b.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(segments) != 1 {
+		t.Fatalf("expected only the active segment to remain, got %d segments", len(segments))
+	}
+}
+
+func TestDurableBusCompactKeepsLatestPerKey(t *testing.T) {
+	b := openDurableTestBus(t, t.TempDir(), WithSegmentSize[durableTestMsg](100),
+		WithCompactionKey(func(msg durableTestMsg) string { return msg.Key }))
+	for i := 0; i < 10; i++ {
+		b.Publish(durableTestMsg{fmt.Sprint("k", i%3), i})
+	}
+	if err := b.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	msgs := drainDurable(t, b)
+	if len(msgs) == 10 {
+		t.Fatal("expected superseded messages to be removed")
+	}
+	latest := map[string]int{}
+	for _, msg := range msgs {
+		if v, ok := latest[msg.Key]; ok && v > msg.Value {
+			t.Fatalf("messages out of order: %v after %v", msg.Value, v)
+		}
+		latest[msg.Key] = msg.Value
+	}
+	if fmt.Sprint(latest) != "map[k0:9 k1:7 k2:8]" {
+		t.Fatalf("expected latest value per key to be retained, got %v", latest)
+	}
+}
+
+// drainDurable returns all messages currently retained by b.
+func drainDurable(t *testing.T, b DurableBus[durableTestMsg]) (msgs []durableTestMsg) {
+	c := make(chan durableTestMsg, 100)
+	unsubscribe, err := b.SubscribeFrom(0, func(msg durableTestMsg) { c <- msg })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	for {
+		select {
+		case msg := <-c:
+			msgs = append(msgs, msg)
+		case <-time.After(50 * time.Millisecond):
+			return msgs
+		}
+	}
+}
+
+func TestDurableBusRecoversFromTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	b := openDurableTestBus(t, dir)
+	for i := 0; i < 3; i++ {
+		b.Publish(durableTestMsg{"a", i})
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 0, 42, 1, 2}) // partial header
+	_ = f.Close()
+
+	b = openDurableTestBus(t, dir)
+	if offset, err := b.Append(durableTestMsg{"a", 3}); err != nil || offset != 3 {
+		t.Fatalf("expected offset 3, got %d (%v)", offset, err)
+	}
+	if msgs := drainDurable(t, b); fmt.Sprint(msgs) != "[{a 0} {a 1} {a 2} {a 3}]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestDurableBusClosed(t *testing.T) {
+	b := openDurableTestBus(t, t.TempDir())
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Append(durableTestMsg{}); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if _, err := b.SubscribeFrom(0, func(durableTestMsg) {}); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,473 @@
+package bus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A record is stored as: length of data (4 bytes), crc32 of everything after
+// the crc (4 bytes), offset (8 bytes), unix timestamp in nanoseconds (8 bytes)
+// followed by the data. All integers are big-endian.
+const (
+	recordHeaderLen = 24
+	recordMaxLen    = 1 << 30
+	segmentSuffix   = ".log"
+)
+
+var errCorruptRecord = errors.New("corrupt record")
+
+type record struct {
+	offset uint64
+	time   int64
+	data   []byte
+}
+
+// A segment is a single file of the log. Only the last segment of the log
+// is appended to.
+type segment struct {
+	base     uint64 // offset of the first record
+	next     uint64 // offset after the last record
+	size     int64
+	lastTime int64
+	path     string
+	f        *os.File
+	removed  bool // deleted by retention or replaced by compaction
+}
+
+// durableLog is a segmented, append-only log of records on disk.
+type durableLog struct {
+	dir          string
+	mtx          *sync.RWMutex
+	segs         []*segment // ordered by base, the last segment is active
+	next         uint64
+	appended     chan struct{} // closed and replaced on every append
+	closed       bool
+	segmentBytes int64
+	maxBytes     int64
+	maxAge       time.Duration
+	syncWrites   bool
+}
+
+func openDurableLog(dir string, segmentBytes, maxBytes int64, maxAge time.Duration, syncWrites bool) (*durableLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &durableLog{
+		dir:          dir,
+		mtx:          &sync.RWMutex{},
+		appended:     make(chan struct{}),
+		segmentBytes: segmentBytes,
+		maxBytes:     maxBytes,
+		maxAge:       maxAge,
+		syncWrites:   syncWrites,
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var bases []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue // not one of ours
+		}
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool { return bases[i] < bases[j] })
+	for i, base := range bases {
+		seg, err := openSegment(dir, base, i == len(bases)-1)
+		if err != nil {
+			_ = l.closeSegments()
+			return nil, err
+		}
+		l.segs = append(l.segs, seg)
+	}
+	if len(l.segs) == 0 {
+		seg, err := openSegment(dir, 0, true)
+		if err != nil {
+			return nil, err
+		}
+		l.segs = append(l.segs, seg)
+	}
+	l.next = l.active().next
+	l.enforceRetention()
+	return l, nil
+}
+
+// openSegment opens the segment file with the given base offset and rebuilds
+// its metadata. A torn record at the end of the last segment, e.g. due to a
+// crash while appending, is truncated.
+func openSegment(dir string, base uint64, last bool) (*segment, error) {
+	path := filepath.Join(dir, fmt.Sprintf("%020d%s", base, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{base: base, next: base, path: path, f: f}
+	for {
+		rec, n, err := readRecordAt(f, seg.size)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if last {
+				if err = f.Truncate(seg.size); err == nil {
+					break
+				}
+			}
+			_ = f.Close()
+			return nil, fmt.Errorf("segment %s: %w", path, err)
+		}
+		seg.add(rec, n)
+	}
+	return seg, nil
+}
+
+func (s *segment) add(rec record, n int64) {
+	s.lastTime = rec.time
+	s.next = rec.offset + 1
+	s.size += n
+}
+
+func readRecordAt(r io.ReaderAt, pos int64) (rec record, n int64, err error) {
+	header := make([]byte, recordHeaderLen)
+	if m, err := r.ReadAt(header, pos); m == 0 && err == io.EOF {
+		return rec, 0, io.EOF
+	} else if m < recordHeaderLen {
+		return rec, 0, errCorruptRecord
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > recordMaxLen {
+		return rec, 0, errCorruptRecord
+	}
+	data := make([]byte, length)
+	if m, _ := r.ReadAt(data, pos+recordHeaderLen); m < int(length) {
+		return rec, 0, errCorruptRecord
+	}
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(header[8:])
+	_, _ = crc.Write(data)
+	if crc.Sum32() != binary.BigEndian.Uint32(header[4:8]) {
+		return rec, 0, errCorruptRecord
+	}
+	rec.offset = binary.BigEndian.Uint64(header[8:16])
+	rec.time = int64(binary.BigEndian.Uint64(header[16:24]))
+	rec.data = data
+	return rec, recordHeaderLen + int64(length), nil
+}
+
+func encodeRecord(rec record) []byte {
+	buf := make([]byte, recordHeaderLen+len(rec.data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(rec.data)))
+	binary.BigEndian.PutUint64(buf[8:16], rec.offset)
+	binary.BigEndian.PutUint64(buf[16:24], uint64(rec.time))
+	copy(buf[recordHeaderLen:], rec.data)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[8:]))
+	return buf
+}
+
+func (l *durableLog) active() *segment {
+	return l.segs[len(l.segs)-1]
+}
+
+// append writes data as a new record and returns its offset.
+func (l *durableLog) append(data []byte) (offset uint64, err error) {
+	if len(data) > recordMaxLen {
+		return 0, fmt.Errorf("record of %d bytes exceeds the maximum of %d bytes", len(data), recordMaxLen)
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.closed {
+		return 0, ErrClosed
+	}
+	seg := l.active()
+	if seg.size > 0 && seg.size+recordHeaderLen+int64(len(data)) > l.segmentBytes {
+		if seg, err = l.roll(); err != nil {
+			return 0, err
+		}
+	}
+	rec := record{offset: l.next, time: time.Now().UnixNano(), data: data}
+	buf := encodeRecord(rec)
+	if _, err = seg.f.WriteAt(buf, seg.size); err != nil {
+		_ = seg.f.Truncate(seg.size) // drop a partially written record
+		return 0, err
+	}
+	if l.syncWrites {
+		if err = seg.f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	seg.add(rec, int64(len(buf)))
+	l.next++
+	close(l.appended)
+	l.appended = make(chan struct{})
+	return rec.offset, nil
+}
+
+// roll starts a new active segment. Must be called with the write lock held.
+func (l *durableLog) roll() (*segment, error) {
+	if l.syncWrites {
+		if err := l.active().f.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	seg, err := openSegment(l.dir, l.next, true)
+	if err != nil {
+		return nil, err
+	}
+	l.segs = append(l.segs, seg)
+	l.enforceRetention()
+	return seg, nil
+}
+
+// enforceRetention deletes the oldest segments while the log exceeds its
+// maximum size or they only hold records older than the maximum age. The
+// active segment is never deleted. Must be called with the write lock held.
+func (l *durableLog) enforceRetention() {
+	var total int64
+	for _, seg := range l.segs {
+		total += seg.size
+	}
+	minTime := time.Now().Add(-l.maxAge).UnixNano()
+	for len(l.segs) > 1 {
+		seg := l.segs[0]
+		tooBig := l.maxBytes > 0 && total > l.maxBytes
+		tooOld := l.maxAge > 0 && seg.lastTime < minTime
+		if !tooBig && !tooOld {
+			return
+		}
+		total -= seg.size
+		l.removeSegment(seg)
+		l.segs = l.segs[1:]
+	}
+}
+
+func (l *durableLog) removeSegment(seg *segment) {
+	seg.removed = true
+	_ = seg.f.Close()
+	_ = os.Remove(seg.path)
+}
+
+// retain enforces the retention limits, e.g. to delete segments that became
+// too old since the last append.
+func (l *durableLog) retain() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if !l.closed {
+		l.enforceRetention()
+	}
+}
+
+// nextOffset returns the offset the next appended record will have.
+func (l *durableLog) nextOffset() uint64 {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.next
+}
+
+// A cursor is the read position of a reader of the log.
+type cursor struct {
+	seg  *segment
+	pos  int64
+	next uint64 // offset of the next record to return
+}
+
+// read returns the next record at or after c.next. If the cursor has read
+// everything in the log, a channel is returned instead which is closed once
+// a new record is appended.
+func (l *durableLog) read(c *cursor) (rec record, wait <-chan struct{}, err error) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	for {
+		if l.closed {
+			return rec, nil, ErrClosed
+		}
+		if c.seg == nil || c.seg.removed {
+			l.seek(c)
+		}
+		if c.pos >= c.seg.size {
+			i := l.segmentIndex(c.seg)
+			if i == len(l.segs)-1 {
+				return rec, l.appended, nil
+			}
+			c.seg, c.pos = l.segs[i+1], 0
+			continue
+		}
+		rec, n, err := readRecordAt(c.seg.f, c.pos)
+		if err != nil {
+			return rec, nil, fmt.Errorf("segment %s: %w", c.seg.path, err)
+		}
+		c.pos += n
+		if rec.offset < c.next {
+			continue // before the requested offset
+		}
+		c.next = rec.offset + 1
+		return rec, nil, nil
+	}
+}
+
+// seek positions c at the start of the first segment that holds records at or
+// after c.next. Must be called with the read lock held.
+func (l *durableLog) seek(c *cursor) {
+	for _, seg := range l.segs {
+		if seg.next > c.next {
+			c.seg, c.pos = seg, 0
+			return
+		}
+	}
+	c.seg, c.pos = l.active(), l.active().size
+}
+
+func (l *durableLog) segmentIndex(seg *segment) int {
+	for i, s := range l.segs {
+		if s == seg {
+			return i
+		}
+	}
+	return len(l.segs) - 1
+}
+
+// offsetAt returns the offset of the first record that was appended at or
+// after t.
+func (l *durableLog) offsetAt(t time.Time) (uint64, error) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	if l.closed {
+		return 0, ErrClosed
+	}
+	nanos := t.UnixNano()
+	for _, seg := range l.segs {
+		if seg.size == 0 || seg.lastTime < nanos {
+			continue
+		}
+		for pos := int64(0); pos < seg.size; {
+			rec, n, err := readRecordAt(seg.f, pos)
+			if err != nil {
+				return 0, fmt.Errorf("segment %s: %w", seg.path, err)
+			}
+			if rec.time >= nanos {
+				return rec.offset, nil
+			}
+			pos += n
+		}
+	}
+	return l.next, nil
+}
+
+// compact rewrites all but the active segment so that they only retain the
+// latest record for every key. Appends are blocked while compacting.
+func (l *durableLog) compact(key func(data []byte) (string, error)) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	latest := map[string]uint64{}
+	for _, seg := range l.segs {
+		for pos := int64(0); pos < seg.size; {
+			rec, n, err := readRecordAt(seg.f, pos)
+			if err != nil {
+				return fmt.Errorf("segment %s: %w", seg.path, err)
+			}
+			k, err := key(rec.data)
+			if err != nil {
+				return err
+			}
+			latest[k] = rec.offset
+			pos += n
+		}
+	}
+	segs := make([]*segment, 0, len(l.segs))
+	for i, seg := range l.segs[:len(l.segs)-1] {
+		compacted, err := l.compactSegment(seg, key, latest)
+		if compacted != nil {
+			segs = append(segs, compacted)
+		}
+		if err != nil {
+			l.segs = append(segs, l.segs[i+1:]...)
+			return err
+		}
+	}
+	l.segs = append(segs, l.active())
+	return nil
+}
+
+// compactSegment writes the records of seg that are the latest for their key
+// to a new file which replaces seg. Returns nil if no record was retained. On
+// error, the segment that is in place of seg is returned, if any.
+func (l *durableLog) compactSegment(seg *segment, key func(data []byte) (string, error),
+	latest map[string]uint64) (*segment, error) {
+	tmpPath := seg.path + ".compact"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	var written int64
+	for pos := int64(0); pos < seg.size; {
+		rec, n, err := readRecordAt(seg.f, pos)
+		if err == nil {
+			var k string
+			if k, err = key(rec.data); err == nil && latest[k] == rec.offset {
+				_, err = tmp.Write(encodeRecord(rec))
+				written += n
+			}
+		}
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+			return seg, err
+		}
+		pos += n
+	}
+	if err = tmp.Sync(); err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return seg, err
+	}
+	if written == 0 {
+		_ = os.Remove(tmpPath)
+		l.removeSegment(seg)
+		return nil, nil
+	}
+	seg.removed = true
+	_ = seg.f.Close()
+	renameErr := os.Rename(tmpPath, seg.path)
+	compacted, err := openSegment(l.dir, seg.base, false)
+	return compacted, errors.Join(renameErr, err)
+}
+
+func (l *durableLog) close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.appended) // wake up waiting readers
+	return l.closeSegments()
+}
+
+func (l *durableLog) closeSegments() error {
+	var errs []error
+	for _, seg := range l.segs {
+		errs = append(errs, seg.f.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,129 @@
+package bus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// An Envelope wraps a message with metadata, see EnvelopeBus.
+type Envelope[E any] struct {
+	Id            string // unique, consists of a random prefix of the EnvelopeBus and Seq
+	Seq           uint64 // increases by one with every message of the EnvelopeBus
+	Time          time.Time
+	Source        string
+	CorrelationId string
+	TraceId       string
+	Headers       map[string]string
+	Msg           E
+}
+
+// Context returns a context that carries the correlation and trace ID of the
+// Envelope. Messages published with it belong to the same flow.
+func (e Envelope[E]) Context() context.Context {
+	ctx := ContextWithCorrelationId(context.Background(), e.CorrelationId)
+	if e.TraceId != "" {
+		ctx = ContextWithTraceId(ctx, e.TraceId)
+	}
+	return ctx
+}
+
+// An EnvelopeSubscriber is called with the Envelope of every message that is
+// published on an EnvelopeBus.
+type EnvelopeSubscriber[E any] func(env Envelope[E])
+
+// An EnvelopeBus stamps every message with an Envelope. Correlation and trace
+// IDs are taken from the context the message is published with. A message
+// that is published without a correlation ID starts a new flow, its
+// correlation ID is its own Id.
+type EnvelopeBus[E any] interface {
+	// Bus.Publish publishes the message without headers or context.
+	// Bus.Subscribe receives the messages without their Envelope.
+	Bus[E]
+
+	// PublishEnvelope publishes msg with the given headers and the IDs
+	// carried by ctx. The headers are copied.
+	PublishEnvelope(ctx context.Context, msg E, headers map[string]string)
+
+	// SubscribeEnvelope subscribes to the Envelopes of all messages.
+	SubscribeEnvelope(sub EnvelopeSubscriber[E]) (unsubscribe func())
+}
+
+type envelopeBusImpl[E any] struct {
+	b      Bus[Envelope[E]]
+	source string
+	prefix string
+	seq    atomic.Uint64
+}
+
+// NewEnvelopeBus creates an EnvelopeBus that publishes the Envelopes on b,
+// e.g. a WorkerBus[Envelope[E]]. Every Envelope carries the given source.
+func NewEnvelopeBus[E any](b Bus[Envelope[E]], source string) EnvelopeBus[E] {
+	prefix := make([]byte, 4)
+	_, _ = rand.Read(prefix) // never fails
+	return &envelopeBusImpl[E]{
+		b:      b,
+		source: source,
+		prefix: hex.EncodeToString(prefix) + "-",
+	}
+}
+
+func (b *envelopeBusImpl[E]) Publish(msg E) {
+	b.PublishEnvelope(context.Background(), msg, nil)
+}
+
+func (b *envelopeBusImpl[E]) PublishEnvelope(ctx context.Context, msg E, headers map[string]string) {
+	seq := b.seq.Add(1)
+	env := Envelope[E]{
+		Id:            b.prefix + strconv.FormatUint(seq, 10),
+		Seq:           seq,
+		Time:          time.Now(),
+		Source:        b.source,
+		CorrelationId: CorrelationId(ctx),
+		TraceId:       TraceId(ctx),
+		Headers:       maps.Clone(headers),
+		Msg:           msg,
+	}
+	if env.CorrelationId == "" {
+		env.CorrelationId = env.Id
+	}
+	b.b.Publish(env)
+}
+
+func (b *envelopeBusImpl[E]) Subscribe(sub Subscriber[E]) (unsubscribe func()) {
+	return b.b.Subscribe(func(env Envelope[E]) { sub(env.Msg) })
+}
+
+func (b *envelopeBusImpl[E]) SubscribeEnvelope(sub EnvelopeSubscriber[E]) (unsubscribe func()) {
+	return b.b.Subscribe(Subscriber[Envelope[E]](sub))
+}
+
+type correlationIdKey struct{}
+
+type traceIdKey struct{}
+
+// ContextWithCorrelationId returns a copy of ctx that carries the correlation ID.
+func ContextWithCorrelationId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIdKey{}, id)
+}
+
+// CorrelationId returns the correlation ID carried by ctx or "" if there is none.
+func CorrelationId(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIdKey{}).(string)
+	return id
+}
+
+// ContextWithTraceId returns a copy of ctx that carries the trace ID.
+func ContextWithTraceId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIdKey{}, id)
+}
+
+// TraceId returns the trace ID carried by ctx or "" if there is none.
+func TraceId(ctx context.Context) string {
+	id, _ := ctx.Value(traceIdKey{}).(string)
+	return id
+}
@@ -0,0 +1,75 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestEnvelopeBusStampsMessages(t *testing.T) {
+	b := NewEnvelopeBus(NewBus[Envelope[string]](), "orders")
+	var envs []Envelope[string]
+	b.SubscribeEnvelope(func(env Envelope[string]) { envs = append(envs, env) })
+	var msgs []string
+	b.Subscribe(func(msg string) { msgs = append(msgs, msg) })
+
+	start := time.Now()
+	headers := map[string]string{"user": "gopher"}
+	b.Publish("created")
+	b.PublishEnvelope(context.Background(), "paid", headers)
+	headers["user"] = "changed"
+
+	if len(envs) != 2 || len(msgs) != 2 || msgs[1] != "paid" {
+		t.Fatalf("unexpected deliveries: %v %v", envs, msgs)
+	}
+	for i, env := range envs {
+		if env.Seq != uint64(i+1) || !strings.HasSuffix(env.Id, fmt.Sprintf("-%d", i+1)) {
+			t.Fatalf("unexpected sequence number or id: %+v", env)
+		}
+		if env.Source != "orders" || env.Time.Before(start) || env.CorrelationId != env.Id || env.TraceId != "" {
+			t.Fatalf("unexpected metadata: %+v", env)
+		}
+	}
+	if envs[1].Headers["user"] != "gopher" {
+		t.Fatalf("expected headers to be copied, got %v", envs[1].Headers)
+	}
+}
+
+func TestEnvelopeBusPropagatesIdsFromContext(t *testing.T) {
+	b := NewEnvelopeBus(NewBus[Envelope[int]](), "test")
+	var envs []Envelope[int]
+	b.SubscribeEnvelope(func(env Envelope[int]) {
+		envs = append(envs, env)
+		if env.Msg == 1 {
+			b.PublishEnvelope(env.Context(), 2, nil) // follow-up in the same flow
+		}
+	})
+	ctx := ContextWithTraceId(ContextWithCorrelationId(context.Background(), "request-42"), "trace-7")
+	b.PublishEnvelope(ctx, 1, nil)
+	if len(envs) != 2 {
+		t.Fatalf("expected 2 envelopes, got %v", envs)
+	}
+	for _, env := range envs {
+		if env.CorrelationId != "request-42" || env.TraceId != "trace-7" {
+			t.Fatalf("expected ids to be propagated, got %+v", env)
+		}
+	}
+}
+
+func TestEnvelopeIdsAreUniqueAcrossBuses(t *testing.T) {
+	b1 := NewEnvelopeBus(NewBus[Envelope[int]](), "a")
+	b2 := NewEnvelopeBus(NewBus[Envelope[int]](), "b")
+	ids := map[string]bool{}
+	for _, b := range []EnvelopeBus[int]{b1, b2} {
+		b.SubscribeEnvelope(func(env Envelope[int]) { ids[env.Id] = true })
+		b.Publish(1)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("expected unique ids, got %v", ids)
+	}
+}
@@ -0,0 +1,166 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnsupportedOption is returned by WorkerBus.SubscribeGroup if it is given
+// a SubscribeOption that does not apply to members of a group.
+var ErrUnsupportedOption = errors.New("unsupported option")
+
+// A GroupStrategy determines which member of a group receives a message, see
+// WorkerBus.SubscribeGroup.
+type GroupStrategy int
+
+const (
+	// RoundRobin hands messages to the members in turn.
+	RoundRobin GroupStrategy = iota
+	// LeastLoaded hands a message to the member with the fewest queued
+	// messages.
+	LeastLoaded
+)
+
+// WithGroupStrategy sets the GroupStrategy of the group the Subscriber joins
+// with SubscribeGroup. The strategy is determined by the first member of a
+// group. The default is RoundRobin.
+func WithGroupStrategy[E any](strategy GroupStrategy) SubscribeOption[E] {
+	return func(o *subscribeOptions[E]) {
+		o.strategy = strategy
+	}
+}
+
+// queueGroup delivers every message to one of its members. It is subscribed
+// to the WorkerBus like any other Subscriber and only exists while it has
+// members.
+type queueGroup[E any] struct {
+	name     string
+	strategy GroupStrategy
+	b        *workerBusImpl[E]
+	entry    *subWithQueue[E] // subscribed to b, dispatches to the members
+
+	mtx     *sync.Mutex
+	members []*subWithQueue[E]
+	next    int
+	closed  bool
+}
+
+func (b *workerBusImpl[E]) SubscribeGroup(group string, sub Subscriber[E], opts ...SubscribeOption[E]) (Subscription, error) {
+	o := newSubscribeOptions(opts)
+	if o.workers != 1 || o.key != nil {
+		return nil, fmt.Errorf("%w: WithWorkers and WithPartitionKey are not supported by SubscribeGroup", ErrUnsupportedOption)
+	}
+	b.subMtx.Lock()
+	defer b.subMtx.Unlock()
+	b.seq++
+	m := newSubWithQueue(b, b.seq, sub, o)
+	if b.stopped {
+		close(m.done) // never receives anything
+		return m, nil
+	}
+	g, ok := b.groups[group]
+	if !ok {
+		g = &queueGroup[E]{name: group, strategy: o.strategy, b: b, mtx: &sync.Mutex{}}
+		b.seq++
+		g.entry = &subWithQueue[E]{id: b.seq, b: b, members: g}
+		b.groups[group] = g
+		b.addSub(g.entry)
+	}
+	m.group = g
+	g.mtx.Lock()
+	g.members = append(g.members, m)
+	g.mtx.Unlock()
+	m.start()
+	b.subscribed()
+	return m, nil
+}
+
+// push hands msg to one of the members. Returns false if the member has to
+// be disconnected, see OverflowPolicy. msg is dropped if there are no members.
+func (g *queueGroup[E]) push(msg queued[E], prio Priority) bool {
+	for {
+		g.mtx.Lock()
+		if g.closed || len(g.members) == 0 {
+			g.mtx.Unlock()
+			return true
+		}
+		m := g.pick()
+		g.mtx.Unlock()
+		q := m.qs[0]
+		switch res := q.push(msg, prio); {
+		case res == pushClosed:
+			continue // m left in the meantime, its messages are redistributed
+		case q.overflowed(res):
+			m.Unsubscribe()
+		}
+		return true
+	}
+}
+
+// pick returns the member that receives the next message. Must be called
+// with mtx held.
+func (g *queueGroup[E]) pick() *subWithQueue[E] {
+	start := g.next % len(g.members)
+	g.next = start + 1
+	m := g.members[start]
+	if g.strategy == LeastLoaded {
+		load := m.qs[0].len()
+		for i := 1; i < len(g.members) && load > 0; i++ {
+			other := g.members[(start+i)%len(g.members)]
+			if l := other.qs[0].len(); l < load {
+				m, load = other, l
+			}
+		}
+	}
+	return m
+}
+
+// leave removes m from the group and hands the messages queued for m to the
+// remaining members. The group is unsubscribed once its last member left,
+// the worker of the last member delivers what is queued for it.
+func (g *queueGroup[E]) leave(m *subWithQueue[E]) {
+	b := g.b
+	b.subMtx.Lock()
+	g.mtx.Lock()
+	found := false
+	for i, member := range g.members {
+		if member == m {
+			g.members = append(g.members[:i:i], g.members[i+1:]...)
+			found = true
+			break
+		}
+	}
+	empty := len(g.members) == 0
+	g.mtx.Unlock()
+	if !found || b.stopped {
+		b.subMtx.Unlock()
+		return // the worker of m delivers what is left
+	}
+	if empty && b.groups[g.name] == g {
+		delete(b.groups, g.name)
+		b.removeSub(g.entry.id)
+	}
+	b.subMtx.Unlock()
+
+	if empty {
+		m.close() // no one to hand the messages to
+		return
+	}
+	msgs := m.qs[0].closeAndTake()
+	m.stop()
+	for _, p := range msgs {
+		g.push(p.msg, p.prio)
+	}
+}
+
+// close closes the queues of all members, they stop once they delivered all
+// queued messages.
+func (g *queueGroup[E]) close() {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.closed = true
+	for _, m := range g.members {
+		m.close()
+	}
+}
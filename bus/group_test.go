@@ -0,0 +1,171 @@
+package bus
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestSubscribeGroupDeliversEachMessageOnce(t *testing.T) {
+	b := NewWorkerBus[int](100)
+	mtx := &sync.Mutex{}
+	perMember := map[int][]int{}
+	for i := 0; i < 3; i++ {
+		b.SubscribeGroup("workers", func(msg int) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			perMember[i] = append(perMember[i], msg)
+		})
+	}
+	var all []int
+	b.Subscribe(func(msg int) { all = append(all, msg) })
+	for i := 0; i < 30; i++ {
+		b.Publish(i)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var received []int
+	for i := 0; i < 3; i++ {
+		if len(perMember[i]) != 10 {
+			t.Fatalf("expected round-robin to hand 10 messages to every member, got %v", perMember)
+		}
+		received = append(received, perMember[i]...)
+	}
+	sort.Ints(received)
+	for i, msg := range received {
+		if msg != i {
+			t.Fatalf("expected every message exactly once, got %v", received)
+		}
+	}
+	if len(all) != 30 {
+		t.Fatalf("expected a regular Subscriber to receive all messages, got %d", len(all))
+	}
+}
+
+func TestSubscribeGroupLeastLoaded(t *testing.T) {
+	b := NewWorkerBus[int](100)
+	release := make(chan struct{})
+	slow := make(chan int, 100)
+	fast := make(chan int, 100)
+	b.SubscribeGroup("workers", func(msg int) {
+		<-release
+		slow <- msg
+	}, WithGroupStrategy[int](LeastLoaded))
+	b.SubscribeGroup("workers", func(msg int) { fast <- msg })
+	for i := 0; i < 20; i++ {
+		b.Publish(i)
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(slow)+len(fast) != 20 || len(slow) > 3 {
+		t.Fatalf("expected the busy member to receive few messages, got %d of %d", len(slow), len(slow)+len(fast))
+	}
+}
+
+func TestSubscribeGroupRedistributesOnUnsubscribe(t *testing.T) {
+	b := NewWorkerBus[int](100)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var first []int
+	s, _ := b.SubscribeGroup("workers", func(msg int) {
+		if len(first) == 0 {
+			close(started)
+			<-release
+		}
+		first = append(first, msg)
+	})
+	b.Publish(0)
+	<-started
+	for i := 1; i < 10; i++ {
+		b.Publish(i) // all queued for the only member
+	}
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan int, 100)
+	b.SubscribeGroup("workers", func(msg int) { second <- msg })
+	s.Unsubscribe()
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || first[0] != 0 {
+		t.Fatalf("expected the leaving member to only finish its current message, got %v", first)
+	}
+	if msgs := drainInts(second); len(msgs) != 9 || msgs[0] != 1 || msgs[8] != 9 {
+		t.Fatalf("expected queued messages to be handed to the other member, got %v", msgs)
+	}
+}
+
+func TestSubscribeGroupLastMemberDeliversQueuedMessages(t *testing.T) {
+	b := NewWorkerBus[int](100)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var received []int
+	s, _ := b.SubscribeGroup("workers", func(msg int) {
+		if len(received) == 0 {
+			close(started)
+			<-release
+		}
+		received = append(received, msg)
+	})
+	b.Publish(0)
+	<-started
+	for i := 1; i < 10; i++ {
+		b.Publish(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	s.Unsubscribe()
+	close(release)
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the last member did not stop")
+	}
+	if len(received) != 10 || received[9] != 9 {
+		t.Fatalf("expected the last member to deliver its queued messages, got %v", received)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribeGroupRejectsWorkers(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	defer func() { _ = b.Close() }()
+	if _, err := b.SubscribeGroup("workers", func(int) {}, WithWorkers[int](2)); !errors.Is(err, ErrUnsupportedOption) {
+		t.Fatalf("expected ErrUnsupportedOption, got %v", err)
+	}
+	if _, err := b.SubscribeGroup("workers", func(int) {}, WithPartitionKey(func(msg int) int { return msg })); !errors.Is(err, ErrUnsupportedOption) {
+		t.Fatalf("expected ErrUnsupportedOption, got %v", err)
+	}
+	if stats := b.Stats(); stats.Subscribers != 0 {
+		t.Fatalf("expected no member to join, got %+v", stats)
+	}
+}
+
+func TestSubscribeGroupIsRemovedWithLastMember(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	defer func() { _ = b.Close() }()
+	s, _ := b.SubscribeGroup("workers", func(int) {})
+	s.Unsubscribe()
+	s.Unsubscribe()
+	impl := b.(*workerBusImpl[int])
+	impl.subMtx.Lock()
+	groups, subs := len(impl.groups), len(*impl.subs.Load())
+	impl.subMtx.Unlock()
+	if groups != 0 || subs != 0 {
+		t.Fatalf("expected group to be removed, %d groups and %d subscribers left", groups, subs)
+	}
+	received := make(chan int, 1)
+	b.SubscribeGroup("workers", func(msg int) { received <- msg })
+	b.Publish(1)
+	expectMsg(t, received, 1)
+}
@@ -0,0 +1,114 @@
+package bus
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// A PublishInterceptor is called for every message that is published. It
+// passes the message on by calling next, possibly after modifying it, or
+// drops it by not calling next. Code after next runs once the message was
+// delivered by a Bus or queued by a WorkerBus.
+type PublishInterceptor[E any] func(msg E, next func(msg E))
+
+// A DeliveryInterceptor is called for every message that is delivered to a
+// Subscriber, in the go-routine the Subscriber is called in. Like a
+// PublishInterceptor it may modify or drop the message. Code after next runs
+// once the Subscriber returned.
+type DeliveryInterceptor[E any] func(subscriberId int64, msg E, next func(msg E))
+
+// WithPublishInterceptors adds interceptors that are called for every message
+// that is published on a Bus, a WorkerBus, a ReplayBus or a BehaviorBus, and
+// for every message a bus created by DialBus receives. The first interceptor
+// is the outermost one.
+func WithPublishInterceptors[E any](interceptors ...PublishInterceptor[E]) PublishOption[E] {
+	return func(o *options[E]) {
+		o.publishInterceptors = append(o.publishInterceptors, interceptors...)
+	}
+}
+
+// WithDeliveryInterceptors adds interceptors that are called for every message
+// that is delivered to a Subscriber. The first interceptor is the outermost
+// one. Panics of the Subscriber pass through the interceptors before they
+// are recovered, see WithPanicHandler.
+func WithDeliveryInterceptors[E any](interceptors ...DeliveryInterceptor[E]) DeliveryOption[E] {
+	return func(o *options[E]) {
+		o.deliveryInterceptors = append(o.deliveryInterceptors, interceptors...)
+	}
+}
+
+// LogPublishes returns a PublishInterceptor that logs every published message
+// at the given level. A nil logger logs to slog.Default().
+func LogPublishes[E any](logger *slog.Logger, level slog.Level) PublishInterceptor[E] {
+	return func(msg E, next func(msg E)) {
+		orDefault(logger).Log(context.Background(), level, "bus: publish", "payload", msg)
+		next(msg)
+	}
+}
+
+// LogDeliveries returns a DeliveryInterceptor that logs every delivered
+// message at the given level together with the time the Subscriber took. A
+// nil logger logs to slog.Default().
+func LogDeliveries[E any](logger *slog.Logger, level slog.Level) DeliveryInterceptor[E] {
+	return func(subscriberId int64, msg E, next func(msg E)) {
+		start := time.Now()
+		next(msg)
+		orDefault(logger).Log(context.Background(), level, "bus: delivered",
+			"subscriber", subscriberId, "payload", msg, "duration", time.Since(start))
+	}
+}
+
+// MeasurePublishLatency returns a PublishInterceptor that reports how long
+// Publish took, i.e. until all Subscribers of a Bus handled the message or
+// until a WorkerBus queued it.
+func MeasurePublishLatency[E any](observe func(d time.Duration)) PublishInterceptor[E] {
+	return func(msg E, next func(msg E)) {
+		start := time.Now()
+		defer func() { observe(time.Since(start)) }()
+		next(msg)
+	}
+}
+
+// MeasureDeliveryLatency returns a DeliveryInterceptor that reports how long
+// a Subscriber took to handle a message, including when it panicked.
+func MeasureDeliveryLatency[E any](observe func(subscriberId int64, d time.Duration)) DeliveryInterceptor[E] {
+	return func(subscriberId int64, msg E, next func(msg E)) {
+		start := time.Now()
+		defer func() { observe(subscriberId, time.Since(start)) }()
+		next(msg)
+	}
+}
+
+func orDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// interceptPublish passes msg through the publish interceptors starting at
+// the i-th one and finally hands it to publish.
+func (o *options[E]) interceptPublish(i int, msg E, publish func(msg E)) {
+	if i == len(o.publishInterceptors) {
+		publish(msg)
+		return
+	}
+	o.publishInterceptors[i](msg, func(msg E) {
+		o.interceptPublish(i+1, msg, publish)
+	})
+}
+
+// interceptDelivery passes msg through the delivery interceptors starting at
+// the i-th one and finally hands it to sub, counting it in delivered.
+func (o *options[E]) interceptDelivery(i int, subscriberId int64, sub Subscriber[E], msg E, delivered *atomic.Uint64) {
+	if i == len(o.deliveryInterceptors) {
+		count(delivered)
+		sub(msg)
+		return
+	}
+	o.deliveryInterceptors[i](subscriberId, msg, func(msg E) {
+		o.interceptDelivery(i+1, subscriberId, sub, msg, delivered)
+	})
+}
@@ -0,0 +1,153 @@
+package bus
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestBusPublishInterceptorsModifyAndDrop(t *testing.T) {
+	var order []string
+	b := NewBus[int](WithPublishInterceptors(
+		func(msg int, next func(int)) {
+			order = append(order, "outer")
+			if msg < 0 {
+				return // drop
+			}
+			next(msg * 10)
+		},
+		func(msg int, next func(int)) {
+			order = append(order, "inner")
+			next(msg + 1)
+		},
+	))
+	var msgs []int
+	b.Subscribe(func(msg int) { msgs = append(msgs, msg) })
+	b.Publish(1)
+	b.Publish(-1)
+	if fmt.Sprint(msgs) != "[11]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+	if fmt.Sprint(order) != "[outer inner outer]" {
+		t.Fatalf("unexpected interceptor order: %v", order)
+	}
+}
+
+func TestBusDeliveryInterceptorsPerSubscriber(t *testing.T) {
+	var ids []int64
+	b := NewBus[int](WithDeliveryInterceptors(func(id int64, msg int, next func(int)) {
+		ids = append(ids, id)
+		if id == 2 {
+			return // drop for the second Subscriber only
+		}
+		next(msg)
+	}))
+	var first, second []int
+	b.Subscribe(func(msg int) { first = append(first, msg) })
+	b.Subscribe(func(msg int) { second = append(second, msg) })
+	b.Publish(1)
+	if fmt.Sprint(first, second, ids) != "[1] [] [1 2]" {
+		t.Fatalf("unexpected deliveries: %v %v %v", first, second, ids)
+	}
+}
+
+func TestBusDeliveryInterceptorSeesPanic(t *testing.T) {
+	var d time.Duration
+	panics := 0
+	b := NewBus[int](
+		WithDeliveryInterceptors(MeasureDeliveryLatency[int](func(_ int64, latency time.Duration) { d = latency })),
+		WithPanicHandler(func(int, int64, any, []byte) { panics++ }),
+	)
+	b.Subscribe(func(int) {
+		time.Sleep(time.Millisecond)
+		panic("boom")
+	})
+	b.Publish(1)
+	if panics != 1 || d < time.Millisecond {
+		t.Fatalf("expected panic to be recovered and latency to be measured, got %d panics and %v", panics, d)
+	}
+}
+
+func TestReplayBusDeliveryInterceptorsSeeEveryDeliveryOnce(t *testing.T) {
+	var intercepted []int
+	b := NewReplayBus(10, 0, WithDeliveryInterceptors(func(id int64, msg int, next func(int)) {
+		intercepted = append(intercepted, msg)
+		next(msg)
+	}))
+	b.Publish(0)
+	var msgs []int
+	b.Subscribe(func(msg int) {
+		msgs = append(msgs, msg)
+		if msg == 0 {
+			b.Publish(1) // held back until the replay finished
+		}
+	})
+	if fmt.Sprint(msgs, intercepted) != "[0 1] [0 1]" {
+		t.Fatalf("unexpected deliveries and interceptions: %v %v", msgs, intercepted)
+	}
+}
+
+func TestWorkerBusInterceptors(t *testing.T) {
+	mtx := &sync.Mutex{}
+	var published []time.Duration
+	delivered := map[int64]int{}
+	b := NewWorkerBus[int](10,
+		WithPublishInterceptors(
+			func(msg int, next func(int)) {
+				if msg%2 == 0 {
+					next(msg)
+				}
+			},
+			MeasurePublishLatency[int](func(d time.Duration) { published = append(published, d) }),
+		),
+		WithDeliveryInterceptors(func(id int64, msg int, next func(int)) {
+			mtx.Lock()
+			delivered[id]++
+			mtx.Unlock()
+			next(msg)
+		}),
+	)
+	var msgs []int
+	b.Subscribe(func(msg int) { msgs = append(msgs, msg) })
+	for i := 0; i < 6; i++ {
+		if !b.PublishTimeout(i, time.Second) {
+			t.Fatal("expected dropped messages to count as published")
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(msgs) != "[0 2 4]" || len(published) != 3 || delivered[1] != 3 {
+		t.Fatalf("unexpected result: %v %v %v", msgs, published, delivered)
+	}
+}
+
+func TestLogInterceptors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, nil))
+	b := NewBus[string](
+		WithPublishInterceptors(LogPublishes[string](logger, slog.LevelInfo)),
+		WithDeliveryInterceptors(LogDeliveries[string](logger, slog.LevelInfo)),
+	)
+	b.Subscribe(func(string) {})
+	b.Publish("hello")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `msg="bus: publish" payload=hello`) ||
+		!strings.Contains(lines[1], "subscriber=1 payload=hello duration=") {
+		t.Fatalf("unexpected log output:\n%s", buf)
+	}
+
+	buf.Reset()
+	b = NewBus[string](WithPublishInterceptors(LogPublishes[string](logger, slog.LevelDebug)))
+	b.Publish("hello")
+	if buf.Len() != 0 {
+		t.Fatalf("expected debug messages to be filtered, got:\n%s", buf)
+	}
+}
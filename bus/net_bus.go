@@ -0,0 +1,423 @@
+package bus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrFrameTooLarge is returned if a connection of ServeBus or DialBus receives
+// a message that exceeds the size set by WithMaxFrameSize.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+const (
+	frameHello byte = iota + 1 // patterns of the client, acknowledged by the server once subscribed
+	frameMsg                   // an encoded message
+)
+
+// netQueueLen is the number of encoded messages that are buffered per
+// connection before the connection is considered too slow.
+const netQueueLen = 1024
+
+// netHandshakeTimeout limits how long DialBus waits for a connection to be
+// established and acknowledged by the server.
+const netHandshakeTimeout = 10 * time.Second
+
+// A RemoteBus is a Bus of another process, see DialBus.
+type RemoteBus[E any] interface {
+	// Bus.Publish sends the message to the other process, which publishes it
+	// on its Bus. It blocks while the connection is being reestablished and
+	// the send buffer is full. Bus.Subscribe subscribes to the messages of
+	// the other process, including the ones published via this RemoteBus.
+	Bus[E]
+
+	// Close closes the connection and stops reconnecting.
+	Close() error
+}
+
+// ServeBus exports b on l, so that other processes can subscribe to and
+// publish on b with DialBus. Every connection is a Subscriber of b. Messages
+// are encoded with the Codec set by WithCodec and are length-prefixed on the
+// wire. A connection that can not keep up with the messages of b is closed,
+// its client reconnects. ServeBus blocks until l is closed, then closes all
+// connections and returns nil.
+func ServeBus[E any](b Bus[E], l net.Listener, opts ...ServeBusOption[E]) error {
+	o := newOptions(opts, ServeBusOption[E].applyServeBus)
+	var (
+		mtx   = &sync.Mutex{}
+		conns = map[net.Conn]bool{}
+		wg    = &sync.WaitGroup{}
+	)
+	defer func() {
+		mtx.Lock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+		mtx.Unlock()
+		wg.Wait()
+	}()
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		mtx.Lock()
+		conns[conn] = true
+		mtx.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveConn(b, conn, &o)
+			mtx.Lock()
+			delete(conns, conn)
+			mtx.Unlock()
+		}()
+	}
+}
+
+// serveConn subscribes conn to b and publishes the messages received from
+// conn until the connection breaks.
+func serveConn[E any](b Bus[E], conn net.Conn, o *options[E]) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	typ, payload, err := readFrame(r, o.maxFrameSize)
+	if err != nil || typ != frameHello {
+		return
+	}
+	var patterns []string
+	if err = json.Unmarshal(payload, &patterns); err != nil {
+		return
+	}
+	topics := make([]TopicPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		tp, err := ParseTopicPattern(pattern)
+		if err != nil {
+			log.Printf("bus: closing connection from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		topics = append(topics, tp)
+	}
+
+	out := make(chan []byte, netQueueLen)
+	stop := make(chan struct{})
+	slow := &sync.Once{}
+	unsubscribe := b.Subscribe(func(msg E) {
+		if !selectsTopic(o.topic, topics, msg) {
+			return
+		}
+		data, err := o.codec.Encode(msg)
+		if err != nil {
+			log.Printf("bus: failed to encode message: %v", err)
+			return
+		}
+		select {
+		case out <- data:
+		case <-stop:
+		default:
+			slow.Do(func() {
+				log.Printf("bus: closing slow connection from %s", conn.RemoteAddr())
+				_ = conn.Close()
+			})
+		}
+	})
+	defer unsubscribe()
+	if err = writeFrame(conn, frameHello, nil); err != nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writeFrames(conn, out, stop)
+	}()
+
+	for {
+		typ, payload, err = readFrame(r, o.maxFrameSize)
+		if err != nil {
+			break
+		}
+		if typ != frameMsg {
+			continue
+		}
+		msg, err := o.codec.Decode(payload)
+		if err != nil {
+			log.Printf("bus: skipped message from %s that could not be decoded: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		b.Publish(msg)
+	}
+	close(stop)
+	<-done
+}
+
+// selectsTopic reports whether msg is selected by any of the topics. All
+// messages are selected if there are no topics.
+func selectsTopic[E any](topic func(msg E) string, topics []TopicPattern, msg E) bool {
+	if len(topics) == 0 {
+		return true
+	}
+	if topic == nil {
+		return false
+	}
+	t := topic(msg)
+	for _, tp := range topics {
+		if tp.Match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+type remoteBusImpl[E any] struct {
+	bus     *busImpl[E] // local Subscribers
+	network string
+	address string
+	hello   []byte
+	out     chan []byte
+
+	mtx       *sync.Mutex
+	conn      net.Conn // the current connection, or the one being dialed
+	closeOnce *sync.Once
+	closed    chan struct{}
+	ctx       context.Context // cancelled by Close to abort dialing
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// DialBus connects to a Bus that another process exports with ServeBus, e.g.
+// DialBus[Event]("unix", "/run/events.sock"). DialBus returns once the other
+// process forwards its messages. An error is returned if the first
+// connection attempt fails or is not acknowledged within 10 seconds or if a
+// pattern given to WithRemoteTopics is malformed. If the connection is lost
+// later on, it is reestablished with the backoff set by WithReconnectPolicy. Messages that are published or
+// received while the connection is lost may get lost as well.
+func DialBus[E any](network, address string, opts ...DialBusOption[E]) (RemoteBus[E], error) {
+	o := newOptions(opts, DialBusOption[E].applyDialBus)
+	for _, pattern := range o.topics {
+		if _, err := ParseTopicPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	hello, err := json.Marshal(o.topics)
+	if err != nil {
+		return nil, err
+	}
+	b := &remoteBusImpl[E]{
+		bus:       newBus(o),
+		network:   network,
+		address:   address,
+		hello:     hello,
+		out:       make(chan []byte, netQueueLen),
+		mtx:       &sync.Mutex{},
+		closeOnce: &sync.Once{},
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	conn, r, err := b.dial()
+	if err != nil {
+		b.cancel()
+		return nil, err
+	}
+	go b.run(conn, r)
+	return b, nil
+}
+
+func (b *remoteBusImpl[E]) Publish(msg E) {
+	data, err := b.bus.opts.codec.Encode(msg)
+	if err != nil {
+		log.Printf("bus: failed to encode message: %v", err)
+		return
+	}
+	select {
+	case b.out <- data:
+	case <-b.closed:
+	}
+}
+
+func (b *remoteBusImpl[E]) Subscribe(sub Subscriber[E]) (unsubscribe func()) {
+	return b.bus.Subscribe(sub)
+}
+
+// Stats reports the local Subscribers and the messages received from the
+// remote bus as published.
+func (b *remoteBusImpl[E]) Stats() Stats {
+	return b.bus.Stats()
+}
+
+func (b *remoteBusImpl[E]) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.closed)
+		b.cancel()
+		b.mtx.Lock()
+		err = b.conn.Close()
+		b.mtx.Unlock()
+	})
+	<-b.done
+	if errors.Is(err, net.ErrClosed) {
+		err = nil // the connection was lost before
+	}
+	return err
+}
+
+// run serves connections until Close is called.
+func (b *remoteBusImpl[E]) run(conn net.Conn, r *bufio.Reader) {
+	defer close(b.done)
+	for conn != nil {
+		err := b.serve(conn, r)
+		select {
+		case <-b.closed:
+			return
+		default:
+		}
+		log.Printf("bus: lost connection to %s, reconnecting: %v", b.address, err)
+		conn, r = b.redial()
+	}
+}
+
+// dial connects to the address and waits until the server acknowledged the
+// patterns of the RemoteBus. The connection is stored in conn right away, so
+// that Close can abort the handshake. Gives up after netHandshakeTimeout.
+func (b *remoteBusImpl[E]) dial() (net.Conn, *bufio.Reader, error) {
+	d := &net.Dialer{Timeout: netHandshakeTimeout}
+	conn, err := d.DialContext(b.ctx, b.network, b.address)
+	if err != nil {
+		return nil, nil, err
+	}
+	b.mtx.Lock()
+	select {
+	case <-b.closed:
+		b.mtx.Unlock()
+		_ = conn.Close()
+		return nil, nil, net.ErrClosed
+	default:
+	}
+	b.conn = conn
+	b.mtx.Unlock()
+	r := bufio.NewReader(conn)
+	err = conn.SetDeadline(time.Now().Add(netHandshakeTimeout))
+	if err == nil {
+		err = writeFrame(conn, frameHello, b.hello)
+	}
+	if err == nil {
+		var typ byte
+		if typ, _, err = readFrame(r, 0); err == nil && typ != frameHello {
+			err = fmt.Errorf("unexpected frame type %d", typ)
+		}
+	}
+	if err == nil {
+		err = conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	return conn, r, nil
+}
+
+// serve sends and receives messages on conn until the connection breaks.
+func (b *remoteBusImpl[E]) serve(conn net.Conn, r *bufio.Reader) error {
+	defer func() { _ = conn.Close() }()
+	o := &b.bus.opts
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writeFrames(conn, b.out, stop)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+	for {
+		typ, payload, err := readFrame(r, o.maxFrameSize)
+		if err != nil {
+			return err
+		}
+		if typ != frameMsg {
+			continue
+		}
+		msg, err := o.codec.Decode(payload)
+		if err != nil {
+			log.Printf("bus: skipped message from %s that could not be decoded: %v", b.address, err)
+			continue
+		}
+		b.bus.Publish(msg)
+	}
+}
+
+// redial connects to the address again with backoff. Returns nil if the
+// RemoteBus was closed in the meantime.
+func (b *remoteBusImpl[E]) redial() (net.Conn, *bufio.Reader) {
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-b.closed:
+			return nil, nil
+		case <-time.After(b.bus.opts.reconnect.backoff(attempt)):
+		}
+		if conn, r, err := b.dial(); err == nil {
+			return conn, r
+		}
+	}
+}
+
+// writeFrames writes the messages of out to conn until stop is closed or
+// writing fails, in which case conn is closed. Writes are buffered and
+// flushed whenever out is empty.
+func writeFrames(conn net.Conn, out <-chan []byte, stop <-chan struct{}) {
+	w := bufio.NewWriter(conn)
+	for {
+		select {
+		case data := <-out:
+			err := writeFrame(w, frameMsg, data)
+			if err == nil && len(out) == 0 {
+				err = w.Flush()
+			}
+			if err != nil {
+				_ = conn.Close()
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// writeFrame writes a frame consisting of its length (4 bytes, big endian,
+// including the type), its type and the payload.
+func writeFrame(w io.Writer, typ byte, payload []byte) error {
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(payload)+1))
+	hdr[4] = typ
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func readFrame(r io.Reader, maxSize int) (typ byte, payload []byte, err error) {
+	var hdr [5]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	size := int(binary.BigEndian.Uint32(hdr[:4]))
+	if size < 1 || size-1 > maxSize {
+		return 0, nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size-1)
+	}
+	payload = make([]byte, size-1)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], payload, nil
+}
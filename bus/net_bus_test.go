@@ -0,0 +1,183 @@
+package bus
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestRemoteBusOverTCP(t *testing.T) {
+	b, l := serveTestBus[int](t, "tcp", "127.0.0.1:0")
+	testRemoteBus(t, b, l)
+}
+
+func TestRemoteBusOverUnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix domain sockets are not available on all windows versions")
+	}
+	b, l := serveTestBus[int](t, "unix", filepath.Join(t.TempDir(), "bus.sock"))
+	testRemoteBus(t, b, l)
+}
+
+func testRemoteBus(t *testing.T, b Bus[int], l net.Listener) {
+	remote, err := DialBus[int](l.Addr().Network(), l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = remote.Close() }()
+	local := make(chan int, 10)
+	b.Subscribe(func(msg int) { local <- msg })
+	received := make(chan int, 10)
+	remote.Subscribe(func(msg int) { received <- msg })
+
+	b.Publish(1)
+	expectMsg(t, received, 1)
+	remote.Publish(2)
+	expectMsg(t, local, 1)
+	expectMsg(t, local, 2)
+	expectMsg(t, received, 2) // the remote bus receives its own messages like any other bus
+}
+
+func TestRemoteBusTopics(t *testing.T) {
+	b, l := serveTestBus(t, "tcp", "127.0.0.1:0", WithTopic(func(msg string) string { return msg }))
+	remote, err := DialBus[string]("tcp", l.Addr().String(), WithRemoteTopics[string]("orders.>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = remote.Close() }()
+	received := make(chan string, 10)
+	remote.Subscribe(func(msg string) { received <- msg })
+	b.Publish("users.created")
+	b.Publish("orders.created")
+	expectMsg(t, received, "orders.created")
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message %q", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestRemoteBusReconnects(t *testing.T) {
+	b, l := serveTestBus[int](t, "tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	remote, err := DialBus[int]("tcp", addr, WithReconnectPolicy[int](RetryPolicy{InitialBackoff: 5 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = remote.Close() }()
+	received := make(chan int, 100)
+	remote.Subscribe(func(msg int) { received <- msg })
+
+	_ = l.Close() // ServeBus closes all connections
+	l2, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("address can not be reused: %v", err)
+	}
+	go func() { _ = ServeBus(b, l2) }()
+	t.Cleanup(func() { _ = l2.Close() })
+
+	deadline := time.After(2 * time.Second)
+	for {
+		b.Publish(1)
+		select {
+		case <-received:
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("remote bus did not reconnect")
+		}
+	}
+}
+
+func TestRemoteBusCloseWhileServerDoesNotAcknowledge(t *testing.T) {
+	_, l := serveTestBus[int](t, "tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	remote, err := DialBus[int]("tcp", addr, WithReconnectPolicy[int](RetryPolicy{InitialBackoff: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = l.Close()
+	l2, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("address can not be reused: %v", err)
+	}
+	defer func() { _ = l2.Close() }()
+	conn, err := l2.Accept() // accept the reconnect, but never acknowledge it
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	closed := make(chan struct{})
+	go func() {
+		_ = remote.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on an unacknowledged connection")
+	}
+}
+
+func TestDialBusErrors(t *testing.T) {
+	_, l := serveTestBus[int](t, "tcp", "127.0.0.1:0")
+	if _, err := DialBus[int]("tcp", l.Addr().String(), WithRemoteTopics[int]("a..b")); !errors.Is(err, ErrInvalidPattern) {
+		t.Fatalf("expected ErrInvalidPattern, got %v", err)
+	}
+	_ = l.Close()
+	if _, err := DialBus[int]("tcp", l.Addr().String()); err == nil {
+		t.Fatal("expected dialing a closed listener to fail")
+	}
+}
+
+func TestReadFrameRejectsLargeFrames(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := writeFrame(buf, frameMsg, make([]byte, 11)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readFrame(bytes.NewReader(buf.Bytes()), 10); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+	typ, payload, err := readFrame(bytes.NewReader(buf.Bytes()), 11)
+	if err != nil || typ != frameMsg || len(payload) != 11 {
+		t.Fatalf("unexpected frame %d %v %v", typ, payload, err)
+	}
+}
+
+func serveTestBus[E any](t *testing.T, network, address string, opts ...ServeBusOption[E]) (Bus[E], net.Listener) {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBus[E]()
+	done := make(chan error, 1)
+	go func() { done <- ServeBus(b, l, opts...) }()
+	t.Cleanup(func() {
+		_ = l.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	return b, l
+}
+
+func expectMsg[E comparable](t *testing.T, msgs <-chan E, expected E) {
+	t.Helper()
+	select {
+	case msg := <-msgs:
+		if msg != expected {
+			t.Fatalf("expected %v, got %v", expected, msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected %v, got nothing", expected)
+	}
+}
@@ -0,0 +1,171 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A DerivedBus is a Bus whose messages are derived from the messages of other
+// buses, see Map, Filter, Merge, Partition, Scan and Window. Derived messages
+// are delivered by the go-routine that delivers the source message, together
+// with its context, see SubscribeWithContext. Messages can also be published
+// on a DerivedBus directly.
+type DerivedBus[E any] interface {
+	Bus[E]
+
+	// Close unsubscribes from the source buses. The Subscriber(s) stay
+	// subscribed but receive no more messages, including the ones published
+	// on the DerivedBus. Calling Close again has no effect.
+	Close() error
+}
+
+type derivedBusImpl[E any] struct {
+	bus       *busImpl[E] // Subscribers of the derived messages
+	closed    atomic.Bool
+	closeOnce *sync.Once
+	release   func() // unsubscribes from the sources, set before the DerivedBus is returned
+}
+
+func newDerivedBus[E any]() *derivedBusImpl[E] {
+	return &derivedBusImpl[E]{bus: NewBus[E]().(*busImpl[E]), closeOnce: &sync.Once{}}
+}
+
+// derive returns a DerivedBus that is subscribed to src with the Subscriber
+// returned by newSub, which publishes on the DerivedBus.
+func derive[A, B any](src Bus[A], newSub func(d *derivedBusImpl[B]) ContextSubscriber[A]) DerivedBus[B] {
+	d := newDerivedBus[B]()
+	d.release = SubscribeWithContext(src, newSub(d)).Unsubscribe
+	return d
+}
+
+// Map returns a DerivedBus that publishes f(msg) for every message of src.
+func Map[A, B any](src Bus[A], f func(msg A) B) DerivedBus[B] {
+	return derive(src, func(d *derivedBusImpl[B]) ContextSubscriber[A] {
+		return func(ctx context.Context, msg A) {
+			d.publish(ctx, f(msg))
+		}
+	})
+}
+
+// Filter returns a DerivedBus that publishes the messages of src for which
+// keep returns true.
+func Filter[E any](src Bus[E], keep func(msg E) bool) DerivedBus[E] {
+	return derive(src, func(d *derivedBusImpl[E]) ContextSubscriber[E] {
+		return func(ctx context.Context, msg E) {
+			if keep(msg) {
+				d.publish(ctx, msg)
+			}
+		}
+	})
+}
+
+// Merge returns a DerivedBus that publishes the messages of all srcs. The
+// messages of different sources may be delivered concurrently.
+func Merge[E any](srcs ...Bus[E]) DerivedBus[E] {
+	d := newDerivedBus[E]()
+	subs := make([]Subscription, len(srcs))
+	for i, src := range srcs {
+		subs[i] = SubscribeWithContext(src, d.publish)
+	}
+	d.release = func() {
+		for _, s := range subs {
+			s.Unsubscribe()
+		}
+	}
+	return d
+}
+
+// Partition splits the messages of src into two DerivedBus(es): matched
+// publishes the messages for which pred returns true, rest all others. Both
+// share a single Subscriber of src, which is unsubscribed once both are
+// closed.
+func Partition[E any](src Bus[E], pred func(msg E) bool) (matched, rest DerivedBus[E]) {
+	m, r := newDerivedBus[E](), newDerivedBus[E]()
+	s := SubscribeWithContext(src, func(ctx context.Context, msg E) {
+		if pred(msg) {
+			m.publish(ctx, msg)
+		} else {
+			r.publish(ctx, msg)
+		}
+	})
+	open := &atomic.Int32{}
+	open.Store(2)
+	release := func() {
+		if open.Add(-1) == 0 {
+			s.Unsubscribe()
+		}
+	}
+	m.release, r.release = release, release
+	return m, r
+}
+
+// Scan returns a DerivedBus that folds the messages of src into an
+// accumulator, starting with initial, and publishes the accumulator after
+// every message, e.g. a running total. Calls of f never overlap, but if src
+// delivers concurrently, the accumulators may be published out of order.
+func Scan[E, S any](src Bus[E], initial S, f func(acc S, msg E) S) DerivedBus[S] {
+	mtx := &sync.Mutex{}
+	acc := initial
+	return derive(src, func(d *derivedBusImpl[S]) ContextSubscriber[E] {
+		return func(ctx context.Context, msg E) {
+			mtx.Lock()
+			acc = f(acc, msg)
+			next := acc
+			mtx.Unlock() // Subscribers may publish on src
+			d.publish(ctx, next)
+		}
+	})
+}
+
+// Window returns a DerivedBus that publishes the messages of src in windows
+// of up to size messages, a window ends once it is full or interval passed
+// since its first message, see Batch. Windows are published without the
+// context of their messages. The messages of an incomplete window are
+// discarded by Close.
+func Window[E any](src Bus[E], size int, interval time.Duration) DerivedBus[[]E] {
+	return derive(src, func(d *derivedBusImpl[[]E]) ContextSubscriber[E] {
+		batch := Batch(size, interval, d.Publish)
+		return func(_ context.Context, msg E) {
+			batch(msg)
+		}
+	})
+}
+
+func (d *derivedBusImpl[E]) Publish(msg E) {
+	d.publish(context.Background(), msg)
+}
+
+// PublishContext publishes msg like Publish and passes ctx on to
+// ContextSubscribers. Returns ErrClosed if the DerivedBus is closed.
+func (d *derivedBusImpl[E]) PublishContext(ctx context.Context, msg E) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+	return d.bus.PublishContext(ctx, msg)
+}
+
+func (d *derivedBusImpl[E]) publish(ctx context.Context, msg E) {
+	_ = d.PublishContext(ctx, msg)
+}
+
+func (d *derivedBusImpl[E]) Subscribe(sub Subscriber[E]) (unsubscribe func()) {
+	return d.bus.Subscribe(sub)
+}
+
+func (d *derivedBusImpl[E]) subscribeGated(sub Subscriber[E], ctxSub ContextSubscriber[E], admit func() bool) (unsubscribe func()) {
+	return d.bus.subscribeGated(sub, ctxSub, admit)
+}
+
+func (d *derivedBusImpl[E]) Stats() Stats {
+	return d.bus.Stats()
+}
+
+func (d *derivedBusImpl[E]) Close() error {
+	d.closeOnce.Do(func() {
+		d.closed.Store(true)
+		d.release()
+	})
+	return nil
+}
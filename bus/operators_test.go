@@ -0,0 +1,167 @@
+package bus
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestMapAndFilter(t *testing.T) {
+	src := NewBus[int]()
+	even := Filter(src, func(msg int) bool { return msg%2 == 0 })
+	labels := Map(even, func(msg int) string { return "#" + strconv.Itoa(msg) })
+	var received []string
+	labels.Subscribe(func(msg string) { received = append(received, msg) })
+	for i := 0; i < 5; i++ {
+		src.Publish(i)
+	}
+	if expected := []string{"#0", "#2", "#4"}; !reflect.DeepEqual(received, expected) {
+		t.Fatalf("expected %v, got %v", expected, received)
+	}
+}
+
+func TestDerivedBusCloseUnsubscribes(t *testing.T) {
+	src := NewBus[int]()
+	d := Map(src, func(msg int) int { return msg * 10 })
+	var received []int
+	d.Subscribe(func(msg int) { received = append(received, msg) })
+	src.Publish(1)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	src.Publish(2)
+	d.Publish(3)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || received[0] != 10 {
+		t.Fatalf("expected no messages after Close, got %v", received)
+	}
+	if stats := src.(Inspector).Stats(); stats.Subscribers != 0 {
+		t.Fatalf("expected the source to have no Subscribers, got %d", stats.Subscribers)
+	}
+}
+
+func TestDerivedBusFromWorkerBus(t *testing.T) {
+	src := NewWorkerBus[int](10)
+	defer func() { _ = src.Close() }()
+	d := Map(src, func(msg int) int { return msg + 1 })
+	received := make(chan int, 10)
+	d.Subscribe(func(msg int) { received <- msg })
+	src.Publish(1)
+	expectMsg(t, received, 2)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	src.Publish(2)
+	if err := src.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 0 {
+		t.Fatalf("expected no messages after Close, got %d", <-received)
+	}
+	if stats := src.Stats(); stats.Subscribers != 0 {
+		t.Fatalf("expected the source to have no Subscribers, got %d", stats.Subscribers)
+	}
+}
+
+func TestDerivedBusPropagatesContext(t *testing.T) {
+	src := NewWorkerBus[int](10)
+	defer func() { _ = src.Close() }()
+	d := Filter(src, func(msg int) bool { return true })
+	defer func() { _ = d.Close() }()
+	values := make(chan any, 10)
+	SubscribeWithContext(Map(d, strconv.Itoa), func(ctx context.Context, msg string) { values <- ctx.Value(ctxKey{}) })
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request-1")
+	if err := src.PublishContext(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	expectMsg[any](t, values, "request-1")
+}
+
+func TestMerge(t *testing.T) {
+	a, b := NewBus[int](), NewBus[int]()
+	m := Merge(a, b)
+	var received []int
+	m.Subscribe(func(msg int) { received = append(received, msg) })
+	a.Publish(1)
+	b.Publish(2)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	a.Publish(3)
+	b.Publish(4)
+	if expected := []int{1, 2}; !reflect.DeepEqual(received, expected) {
+		t.Fatalf("expected %v, got %v", expected, received)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	src := NewBus[int]()
+	small, large := Partition(src, func(msg int) bool { return msg < 10 })
+	var smalls, larges []int
+	small.Subscribe(func(msg int) { smalls = append(smalls, msg) })
+	large.Subscribe(func(msg int) { larges = append(larges, msg) })
+	for _, msg := range []int{1, 20, 3, 40} {
+		src.Publish(msg)
+	}
+	if !reflect.DeepEqual(smalls, []int{1, 3}) || !reflect.DeepEqual(larges, []int{20, 40}) {
+		t.Fatalf("unexpected partitions %v and %v", smalls, larges)
+	}
+
+	_ = small.Close()
+	src.Publish(5)
+	src.Publish(50)
+	if len(smalls) != 2 || len(larges) != 3 {
+		t.Fatalf("expected only the open partition to receive messages, got %v and %v", smalls, larges)
+	}
+	_ = large.Close()
+	if stats := src.(Inspector).Stats(); stats.Subscribers != 0 {
+		t.Fatalf("expected the source to have no Subscribers, got %d", stats.Subscribers)
+	}
+}
+
+func TestScan(t *testing.T) {
+	src := NewBus[int]()
+	totals := Scan(src, 100, func(acc int, msg int) int { return acc + msg })
+	var received []int
+	totals.Subscribe(func(msg int) { received = append(received, msg) })
+	for i := 1; i <= 4; i++ {
+		src.Publish(i)
+	}
+	if expected := []int{101, 103, 106, 110}; !reflect.DeepEqual(received, expected) {
+		t.Fatalf("expected %v, got %v", expected, received)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	src := NewBus[int]()
+	windows := Window(src, 3, 50*time.Millisecond)
+	defer func() { _ = windows.Close() }()
+	received := make(chan []int, 10)
+	windows.Subscribe(func(msg []int) { received <- msg })
+	for i := 0; i < 4; i++ {
+		src.Publish(i)
+	}
+	select {
+	case w := <-received:
+		if !reflect.DeepEqual(w, []int{0, 1, 2}) {
+			t.Fatalf("expected a full window, got %v", w)
+		}
+	default:
+		t.Fatal("expected a full window to be published right away")
+	}
+	select {
+	case w := <-received:
+		if !reflect.DeepEqual(w, []int{3}) {
+			t.Fatalf("expected the incomplete window after the interval, got %v", w)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the incomplete window to be published after the interval")
+	}
+}
@@ -0,0 +1,289 @@
+package bus
+
+import (
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Every constructor takes its own type of option, so that an option the
+// constructor does not support is rejected by the compiler. An option that is
+// supported by several constructors implements the option types of all of
+// them.
+
+// A BusOption configures a Bus created by NewBus, NewReplayBus or
+// NewBehaviorBus.
+type BusOption[E any] interface {
+	applyBus(o *options[E])
+}
+
+// A WorkerBusOption configures a WorkerBus created by NewWorkerBus.
+type WorkerBusOption[E any] interface {
+	applyWorkerBus(o *options[E])
+}
+
+// A DurableBusOption configures a DurableBus opened by OpenDurableBus.
+type DurableBusOption[E any] interface {
+	applyDurableBus(o *options[E])
+}
+
+// A ServeBusOption configures the connections served by ServeBus.
+type ServeBusOption[E any] interface {
+	applyServeBus(o *options[E])
+}
+
+// A DialBusOption configures a RemoteBus created by DialBus.
+type DialBusOption[E any] interface {
+	applyDialBus(o *options[E])
+}
+
+// A DeliveryOption configures how messages are delivered to Subscribers. It
+// is a BusOption, a WorkerBusOption, a DurableBusOption and a DialBusOption.
+type DeliveryOption[E any] func(o *options[E])
+
+func (opt DeliveryOption[E]) applyBus(o *options[E])        { opt(o) }
+func (opt DeliveryOption[E]) applyWorkerBus(o *options[E])  { opt(o) }
+func (opt DeliveryOption[E]) applyDurableBus(o *options[E]) { opt(o) }
+func (opt DeliveryOption[E]) applyDialBus(o *options[E])    { opt(o) }
+
+// A PublishOption configures how messages are published. It is a BusOption,
+// a WorkerBusOption and a DialBusOption.
+type PublishOption[E any] func(o *options[E])
+
+func (opt PublishOption[E]) applyBus(o *options[E])       { opt(o) }
+func (opt PublishOption[E]) applyWorkerBus(o *options[E]) { opt(o) }
+func (opt PublishOption[E]) applyDialBus(o *options[E])   { opt(o) }
+
+// A StatsOption configures the statistics of a bus, see Inspector. It is a
+// BusOption, a WorkerBusOption and a DialBusOption.
+type StatsOption[E any] func(o *options[E])
+
+func (opt StatsOption[E]) applyBus(o *options[E])       { opt(o) }
+func (opt StatsOption[E]) applyWorkerBus(o *options[E]) { opt(o) }
+func (opt StatsOption[E]) applyDialBus(o *options[E])   { opt(o) }
+
+// A CodecOption configures how messages are encoded. It is a
+// WorkerBusOption, a DurableBusOption, a ServeBusOption and a DialBusOption.
+type CodecOption[E any] func(o *options[E])
+
+func (opt CodecOption[E]) applyWorkerBus(o *options[E])  { opt(o) }
+func (opt CodecOption[E]) applyDurableBus(o *options[E]) { opt(o) }
+func (opt CodecOption[E]) applyServeBus(o *options[E])   { opt(o) }
+func (opt CodecOption[E]) applyDialBus(o *options[E])    { opt(o) }
+
+// A ConnOption configures the connections between ServeBus and DialBus. It
+// is a ServeBusOption and a DialBusOption.
+type ConnOption[E any] func(o *options[E])
+
+func (opt ConnOption[E]) applyServeBus(o *options[E]) { opt(o) }
+func (opt ConnOption[E]) applyDialBus(o *options[E])  { opt(o) }
+
+// workerBusOption, durableBusOption, serveBusOption and dialBusOption are
+// the options that are only supported by a single constructor.
+type (
+	workerBusOption[E any]  func(o *options[E])
+	durableBusOption[E any] func(o *options[E])
+	serveBusOption[E any]   func(o *options[E])
+	dialBusOption[E any]    func(o *options[E])
+)
+
+func (opt workerBusOption[E]) applyWorkerBus(o *options[E])   { opt(o) }
+func (opt durableBusOption[E]) applyDurableBus(o *options[E]) { opt(o) }
+func (opt serveBusOption[E]) applyServeBus(o *options[E])     { opt(o) }
+func (opt dialBusOption[E]) applyDialBus(o *options[E])       { opt(o) }
+
+type options[E any] struct {
+	panicHandler PanicHandler[E]
+	maxPanics    int
+	latencyStats bool
+
+	publishInterceptors  []PublishInterceptor[E]
+	deliveryInterceptors []DeliveryInterceptor[E]
+
+	// used by the DurableBus only
+	codec         Codec[E]
+	segmentBytes  int64
+	maxBytes      int64
+	maxAge        time.Duration
+	compactionKey func(msg E) string
+	syncWrites    bool
+
+	// used by the WorkerBus only
+	scheduleFile string
+	priority     PriorityPolicy
+
+	// used by ServeBus and DialBus only
+	topic        func(msg E) string
+	topics       []string
+	reconnect    RetryPolicy
+	maxFrameSize int
+}
+
+// newOptions returns the default options with opts applied by apply, e.g.
+// newOptions(opts, BusOption[E].applyBus).
+func newOptions[E, O any](opts []O, apply func(opt O, o *options[E])) options[E] {
+	o := options[E]{
+		panicHandler: logPanic[E],
+		maxPanics:    0,
+		codec:        GobCodec[E](),
+		segmentBytes: 64 << 20,
+		reconnect: RetryPolicy{
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     5 * time.Second,
+			Multiplier:     2,
+			Jitter:         0.2,
+		},
+		maxFrameSize: 16 << 20,
+		priority:     StrictPriority,
+	}
+	for _, opt := range opts {
+		apply(opt, &o)
+	}
+	return o
+}
+
+// A PanicHandler is called when a Subscriber panics while handling msg. The
+// subscriberId identifies the Subscriber within its Bus, recovered is the value
+// passed to panic and stack the stack trace of the panicking go-routine.
+type PanicHandler[E any] func(msg E, subscriberId int64, recovered any, stack []byte)
+
+// WithPanicHandler sets the PanicHandler that is called whenever a Subscriber
+// panics. By default, panics are recovered and logged with the log package.
+func WithPanicHandler[E any](handler PanicHandler[E]) DeliveryOption[E] {
+	return func(o *options[E]) {
+		if handler != nil {
+			o.panicHandler = handler
+		}
+	}
+}
+
+// WithMaxPanics automatically unsubscribes a Subscriber once it has panicked
+// n times. A non-positive n (the default) never unsubscribes.
+func WithMaxPanics[E any](n int) DeliveryOption[E] {
+	return func(o *options[E]) {
+		o.maxPanics = n
+	}
+}
+
+// WithCodec sets the Codec a DurableBus uses to store messages, ServeBus and
+// DialBus use to transmit them and a WorkerBus uses to persist scheduled
+// messages. The default is GobCodec.
+func WithCodec[E any](codec Codec[E]) CodecOption[E] {
+	return func(o *options[E]) {
+		if codec != nil {
+			o.codec = codec
+		}
+	}
+}
+
+// WithSegmentSize sets the size in bytes after which a DurableBus starts a
+// new segment file. The default is 64 MiB.
+func WithSegmentSize[E any](bytes int64) DurableBusOption[E] {
+	return durableBusOption[E](func(o *options[E]) {
+		if bytes > 0 {
+			o.segmentBytes = bytes
+		}
+	})
+}
+
+// WithRetention lets a DurableBus delete its oldest segments once all of
+// them together exceed maxBytes or once all messages of a segment are older
+// than maxAge. A non-positive value disables the respective limit. The
+// segment that is currently written to is never deleted.
+func WithRetention[E any](maxBytes int64, maxAge time.Duration) DurableBusOption[E] {
+	return durableBusOption[E](func(o *options[E]) {
+		o.maxBytes = maxBytes
+		o.maxAge = maxAge
+	})
+}
+
+// WithCompactionKey sets the key that DurableBus.Compact uses to determine
+// which messages are superseded by a later message with the same key.
+func WithCompactionKey[E any](key func(msg E) string) DurableBusOption[E] {
+	return durableBusOption[E](func(o *options[E]) {
+		o.compactionKey = key
+	})
+}
+
+// WithSyncWrites lets a DurableBus sync its log to stable storage after every
+// message. This is considerably slower but survives power loss.
+func WithSyncWrites[E any]() DurableBusOption[E] {
+	return durableBusOption[E](func(o *options[E]) {
+		o.syncWrites = true
+	})
+}
+
+// WithTopic sets the function ServeBus uses to determine the topic of a
+// message, see WithRemoteTopics.
+func WithTopic[E any](topic func(msg E) string) ServeBusOption[E] {
+	return serveBusOption[E](func(o *options[E]) {
+		o.topic = topic
+	})
+}
+
+// WithRemoteTopics lets a bus created by DialBus only receive messages whose
+// topic matches one of the given patterns, see TopicBus for the syntax.
+// Messages are filtered by the serving process, which must determine topics
+// with WithTopic.
+func WithRemoteTopics[E any](patterns ...string) DialBusOption[E] {
+	return dialBusOption[E](func(o *options[E]) {
+		o.topics = append(o.topics, patterns...)
+	})
+}
+
+// WithReconnectPolicy sets the backoff with which DialBus reconnects after the
+// connection was lost. MaxAttempts is ignored, reconnecting only stops on
+// Close. The default starts at 100ms and backs off to at most 5s.
+func WithReconnectPolicy[E any](p RetryPolicy) DialBusOption[E] {
+	return dialBusOption[E](func(o *options[E]) {
+		o.reconnect = p
+	})
+}
+
+// WithMaxFrameSize sets the maximum size in bytes of an encoded message that
+// ServeBus and DialBus accept. Connections that receive larger messages are
+// closed. The default is 16 MiB.
+func WithMaxFrameSize[E any](bytes int) ConnOption[E] {
+	return func(o *options[E]) {
+		if bytes > 0 {
+			o.maxFrameSize = bytes
+		}
+	}
+}
+
+func logPanic[E any](msg E, subscriberId int64, recovered any, stack []byte) {
+	log.Printf("bus: subscriber %d panicked handling %v: %v\n%s", subscriberId, msg, recovered, stack)
+}
+
+// deliver invokes sub with msg and recovers from a panic of sub. Returns false
+// if sub panicked. delivered, if not nil, counts msg unless a delivery
+// interceptor dropped it.
+func (o *options[E]) deliver(subscriberId int64, sub Subscriber[E], msg E, delivered *atomic.Uint64) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+			o.panicHandler(msg, subscriberId, r, debug.Stack())
+		}
+	}()
+	if len(o.deliveryInterceptors) > 0 {
+		o.interceptDelivery(0, subscriberId, sub, msg, delivered)
+	} else {
+		count(delivered)
+		sub(msg)
+	}
+	return true
+}
+
+// count increments c unless it is nil.
+func count(c *atomic.Uint64) {
+	if c != nil {
+		c.Add(1)
+	}
+}
+
+// exceedsMaxPanics reports whether a Subscriber that has panicked the given
+// number of times must be unsubscribed.
+func (o *options[E]) exceedsMaxPanics(panics int64) bool {
+	return o.maxPanics > 0 && panics >= int64(o.maxPanics)
+}
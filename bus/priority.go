@@ -0,0 +1,102 @@
+package bus
+
+// A Priority selects the lane a message is queued in, see
+// WorkerBus.PublishWithPriority.
+type Priority int
+
+const (
+	// PriorityLow is meant for bulk messages that may wait.
+	PriorityLow Priority = iota
+	// PriorityNormal is the Priority of messages published with Publish.
+	PriorityNormal
+	// PriorityHigh is meant for control messages, e.g. cancelling a job.
+	PriorityHigh
+	// NumPriorities is the number of priority lanes.
+	NumPriorities = 3
+)
+
+// A PriorityPolicy determines which lane a WorkerBus and its Subscribers take
+// the next message from. Messages of the same lane are always handled in the
+// order they were published.
+type PriorityPolicy struct {
+	// Weights sets the share of messages taken from each non-empty lane,
+	// indexed by Priority, e.g. {1, 4, 16} takes 16 high, 4 normal and 1 low
+	// message per round. Lanes without weight are only served once all lanes
+	// with a weight are empty. Without any weights, the highest non-empty
+	// lane is always served first.
+	Weights [NumPriorities]int
+	// MaxOvertakes is the number of messages that may be taken from other
+	// lanes while a lane is waiting, before the waiting lane is served. This
+	// keeps high priorities from starving low ones. 0 disables the bound.
+	MaxOvertakes int
+}
+
+// StrictPriority serves higher lanes first, a lane waits for at most 1000
+// messages of other lanes. It is the default of a WorkerBus.
+var StrictPriority = PriorityPolicy{MaxOvertakes: 1000}
+
+// FairPriority shares the Subscribers between the lanes in the ratio 1:4:16.
+var FairPriority = PriorityPolicy{Weights: [NumPriorities]int{1, 4, 16}}
+
+// WithPriorityPolicy sets the PriorityPolicy of a WorkerBus. The default is
+// StrictPriority.
+func WithPriorityPolicy[E any](policy PriorityPolicy) WorkerBusOption[E] {
+	return workerBusOption[E](func(o *options[E]) {
+		o.priority = policy
+	})
+}
+
+// clamp returns p limited to the valid priorities.
+func (p Priority) clamp() Priority {
+	return min(max(p, PriorityLow), PriorityHigh)
+}
+
+// lanePicker applies a PriorityPolicy. It is not safe for concurrent use.
+type lanePicker struct {
+	policy    PriorityPolicy
+	current   [NumPriorities]int // state of the smooth weighted round-robin
+	overtaken [NumPriorities]int // messages taken from other lanes while the lane was waiting
+}
+
+// pick returns the lane to take the next message from. ready reports which
+// lanes have messages, at least one must have.
+func (p *lanePicker) pick(ready *[NumPriorities]bool) Priority {
+	lane := p.choose(ready)
+	for l := range ready {
+		if ready[l] {
+			p.overtaken[l]++
+		}
+	}
+	p.overtaken[lane] = 0
+	return lane
+}
+
+func (p *lanePicker) choose(ready *[NumPriorities]bool) Priority {
+	if p.policy.MaxOvertakes > 0 {
+		for l := range ready { // lowest lane first, it is the most likely to starve
+			if ready[l] && p.overtaken[l] >= p.policy.MaxOvertakes {
+				return Priority(l)
+			}
+		}
+	}
+	best, total := -1, 0
+	for l := NumPriorities - 1; l >= 0; l-- {
+		if w := p.policy.Weights[l]; ready[l] && w > 0 {
+			p.current[l] += w
+			total += w
+			if best < 0 || p.current[l] > p.current[best] {
+				best = l
+			}
+		}
+	}
+	if best >= 0 {
+		p.current[best] -= total
+		return Priority(best)
+	}
+	for l := NumPriorities - 1; l > 0; l-- {
+		if ready[l] {
+			return Priority(l)
+		}
+	}
+	return PriorityLow
+}
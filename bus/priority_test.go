@@ -0,0 +1,93 @@
+package bus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestPublishWithPriorityStrict(t *testing.T) {
+	b := NewWorkerBus[int](100)
+	defer func() { _ = b.Close() }()
+	release := make(chan struct{})
+	_, received := blockedSubscriber(t, b, release)
+	for i := 0; i < 3; i++ {
+		b.PublishWithPriority(i, PriorityLow)
+		b.Publish(10 + i)
+		b.PublishWithPriority(20+i, PriorityHigh)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{-1, 20, 21, 22, 10, 11, 12, 0, 1, 2}
+	if msgs := drainInts(received); !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("expected %v, got %v", expected, msgs)
+	}
+}
+
+func TestPublishWithPriorityPreventsStarvation(t *testing.T) {
+	b := NewWorkerBus[int](100, WithPriorityPolicy[int](PriorityPolicy{MaxOvertakes: 2}))
+	defer func() { _ = b.Close() }()
+	release := make(chan struct{})
+	_, received := blockedSubscriber(t, b, release)
+	b.PublishWithPriority(0, PriorityLow)
+	for i := 1; i <= 5; i++ {
+		b.PublishWithPriority(i, PriorityHigh)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{-1, 1, 2, 0, 3, 4, 5}
+	if msgs := drainInts(received); !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("expected the low message after 2 overtakes %v, got %v", expected, msgs)
+	}
+}
+
+func TestPublishWithPriorityWeighted(t *testing.T) {
+	b := NewWorkerBus[int](100, WithPriorityPolicy[int](PriorityPolicy{Weights: [NumPriorities]int{1, 0, 2}}))
+	defer func() { _ = b.Close() }()
+	release := make(chan struct{})
+	_, received := blockedSubscriber(t, b, release)
+	for i := 0; i < 4; i++ {
+		b.PublishWithPriority(i, PriorityLow)
+		b.PublishWithPriority(10+i, PriorityHigh)
+		b.Publish(20 + i) // no weight, served once the other lanes are empty
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{-1, 10, 0, 11, 12, 1, 13, 2, 3, 20, 21, 22, 23}
+	if msgs := drainInts(received); !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("expected %v, got %v", expected, msgs)
+	}
+}
+
+func TestPublishWithPriorityOvertakesInBusQueue(t *testing.T) {
+	b := NewWorkerBus[int](1)
+	defer func() { _ = b.Close() }()
+	release := make(chan struct{})
+	_, received := blockedSubscriber(t, b, release)
+	b.Publish(0) // fills the queue of the Subscriber
+	b.Publish(1) // blocks the worker of the bus
+	time.Sleep(10 * time.Millisecond)
+	b.PublishWithPriority(2, PriorityLow)
+	b.PublishWithPriority(3, PriorityHigh)
+	close(release)
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{-1, 0, 1, 3, 2}
+	if msgs := drainInts(received); !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("expected %v, got %v", expected, msgs)
+	}
+}
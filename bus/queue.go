@@ -0,0 +1,319 @@
+package bus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy determines what happens when a message is delivered to a
+// Subscriber of a WorkerBus whose queue is full.
+type OverflowPolicy int
+
+const (
+	// Block waits until there is space in the queue. This stalls delivery to
+	// all other Subscribers of the WorkerBus until the Subscriber catches up.
+	Block OverflowPolicy = iota
+	// DropNewest discards the message that did not fit into the queue.
+	DropNewest
+	// DropOldest discards the oldest queued message of the lowest Priority
+	// to make room.
+	DropOldest
+	// BlockWithTimeout waits up to a timeout for space in the queue and
+	// discards the message if none became available, see WithOverflowTimeout.
+	BlockWithTimeout
+	// Disconnect unsubscribes the Subscriber once its queue overflows.
+	Disconnect
+)
+
+// queue is a bounded FIFO with a single producer and a single consumer. Unlike
+// a channel it can be closed while the producer is pushing and supports the
+// OverflowPolicy(s). Every Priority has its own lane, the lanePicker decides
+// which lane is popped next. The consumer handles a popped message until it
+// pops again.
+type queue[E any] struct {
+	mtx      *sync.Mutex
+	lanes    [NumPriorities]deque[E]
+	size     int // messages in all lanes
+	picker   lanePicker
+	capacity int
+	closed   bool
+	notEmpty chan struct{} // signalled after push and close
+	notFull  chan struct{} // signalled after pop and close
+
+	// messages are numbered from 1 per lane in the order they are pushed
+	pushes       [NumPriorities]uint64 // number of the last pushed message
+	pops         [NumPriorities]uint64 // number of the last popped or dropped message
+	handling     uint64                // number of the message the consumer handles, 0 if none
+	handlingLane Priority              // lane of the message the consumer handles
+	barriers     []queueBarrier        // ordered by pos
+
+	policy  OverflowPolicy
+	timeout time.Duration
+	dropped atomic.Uint64
+}
+
+// prioritized is a message together with its Priority.
+type prioritized[E any] struct {
+	msg  E
+	prio Priority
+}
+
+func newQueue[E any](capacity int, policy OverflowPolicy, timeout time.Duration, priority PriorityPolicy) *queue[E] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &queue[E]{
+		mtx:      &sync.Mutex{},
+		picker:   lanePicker{policy: priority},
+		capacity: capacity,
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		policy:   policy,
+		timeout:  timeout,
+	}
+}
+
+// push enqueues msg in the lane of prio according to the queue's
+// OverflowPolicy. Returns pushFull if msg was dropped or, with policy
+// Disconnect, the queue overflowed. Pushing to a closed queue discards msg
+// and returns pushClosed.
+func (q *queue[E]) push(msg E, prio Priority) pushResult {
+	switch q.policy {
+	case DropNewest, Disconnect:
+		res := q.tryPush(msg, prio)
+		if res == pushFull {
+			q.dropped.Add(1)
+		}
+		return res
+	case DropOldest:
+		q.mtx.Lock()
+		if q.closed {
+			q.mtx.Unlock()
+			return pushClosed
+		}
+		if q.size >= q.capacity {
+			q.dropOldest()
+		}
+		q.pushBack(msg, prio)
+		q.mtx.Unlock()
+		notify(q.notEmpty)
+		return pushed
+	case BlockWithTimeout:
+		t := time.NewTimer(q.timeout)
+		defer t.Stop()
+		res := q.waitPush(msg, prio, t.C)
+		if res == pushFull {
+			q.dropped.Add(1)
+		}
+		return res
+	default:
+		return q.waitPush(msg, prio, nil)
+	}
+}
+
+// overflowed reports whether the result of push requires the Subscriber to be
+// disconnected.
+func (q *queue[E]) overflowed(res pushResult) bool {
+	return res == pushFull && q.policy == Disconnect
+}
+
+type pushResult int
+
+const (
+	pushed pushResult = iota
+	pushFull
+	pushClosed
+)
+
+func (q *queue[E]) tryPush(msg E, prio Priority) pushResult {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.closed {
+		return pushClosed
+	}
+	if q.size >= q.capacity {
+		return pushFull
+	}
+	q.pushBack(msg, prio)
+	notify(q.notEmpty)
+	return pushed
+}
+
+// waitPush blocks until msg is enqueued, the queue is closed or cancel fires.
+func (q *queue[E]) waitPush(msg E, prio Priority, cancel <-chan time.Time) pushResult {
+	for {
+		if res := q.tryPush(msg, prio); res != pushFull {
+			return res
+		}
+		select {
+		case <-q.notFull:
+		case <-cancel:
+			return pushFull
+		}
+	}
+}
+
+// pushBack appends msg to the lane of prio. Must be called with mtx held.
+func (q *queue[E]) pushBack(msg E, prio Priority) {
+	q.lanes[prio].pushBack(msg)
+	q.size++
+	q.pushes[prio]++
+}
+
+// dropOldest discards the oldest message of the lowest non-empty lane. Must
+// be called with mtx held.
+func (q *queue[E]) dropOldest() {
+	for l := range q.lanes {
+		if q.lanes[l].len() > 0 {
+			q.lanes[l].popFront()
+			q.size--
+			q.pops[l]++
+			q.dropped.Add(1)
+			q.releaseBarriers()
+			return
+		}
+	}
+}
+
+// pop blocks until a message is available. Messages that were queued before
+// the queue was closed are still returned. Returns false once the queue is
+// closed and empty. Calling pop marks the previously popped message as handled.
+func (q *queue[E]) pop() (msg E, ok bool) {
+	q.mtx.Lock()
+	q.handling = 0
+	q.releaseBarriers()
+	for q.size == 0 {
+		if q.closed {
+			q.mtx.Unlock()
+			return msg, false
+		}
+		q.mtx.Unlock()
+		<-q.notEmpty
+		q.mtx.Lock()
+	}
+	lane := PriorityNormal
+	if q.lanes[lane].len() != q.size {
+		var ready [NumPriorities]bool
+		for l := range q.lanes {
+			ready[l] = q.lanes[l].len() > 0
+		}
+		lane = q.picker.pick(&ready)
+	}
+	msg = q.lanes[lane].popFront()
+	q.size--
+	q.pops[lane]++
+	q.handling, q.handlingLane = q.pops[lane], lane
+	q.mtx.Unlock()
+	notify(q.notFull)
+	return msg, true
+}
+
+// len returns the number of queued messages.
+func (q *queue[E]) len() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.size
+}
+
+// closeAndTake closes the queue and returns the messages that were not popped
+// yet instead of leaving them to pop, ordered by lane from high to low.
+func (q *queue[E]) closeAndTake() []prioritized[E] {
+	q.mtx.Lock()
+	taken := make([]prioritized[E], 0, q.size)
+	for l := NumPriorities - 1; l >= 0; l-- {
+		for q.lanes[l].len() > 0 {
+			taken = append(taken, prioritized[E]{msg: q.lanes[l].popFront(), prio: Priority(l)})
+			q.pops[l]++
+		}
+	}
+	q.size = 0
+	q.closed = true
+	q.releaseBarriers()
+	q.mtx.Unlock()
+	notify(q.notEmpty)
+	notify(q.notFull)
+	return taken
+}
+
+type queueBarrier struct {
+	pos  [NumPriorities]uint64
+	done chan struct{}
+}
+
+// barrier returns a channel that is closed once every message pushed so far
+// was handled by the consumer, dropped or taken.
+func (q *queue[E]) barrier() <-chan struct{} {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	done := make(chan struct{})
+	q.barriers = append(q.barriers, queueBarrier{pos: q.pushes, done: done})
+	q.releaseBarriers()
+	return done
+}
+
+// releaseBarriers closes the barriers whose messages are all gone. Must be
+// called with mtx held.
+func (q *queue[E]) releaseBarriers() {
+	for len(q.barriers) > 0 {
+		b := q.barriers[0]
+		for l := range b.pos {
+			if q.pops[l] < b.pos[l] {
+				return
+			}
+		}
+		if q.handling != 0 && q.handling <= b.pos[q.handlingLane] {
+			return
+		}
+		close(b.done)
+		q.barriers = q.barriers[1:]
+	}
+}
+
+func (q *queue[E]) close() {
+	q.mtx.Lock()
+	q.closed = true
+	q.mtx.Unlock()
+	notify(q.notEmpty)
+	notify(q.notFull)
+}
+
+// notify wakes up a waiter of c without blocking. Since c has a capacity of
+// one, a signal is never lost if there is no waiter yet.
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// deque is a FIFO backed by a slice that grows on demand.
+type deque[E any] struct {
+	items []E
+	head  int
+}
+
+func (d *deque[E]) len() int {
+	return len(d.items) - d.head
+}
+
+func (d *deque[E]) pushBack(e E) {
+	d.items = append(d.items, e)
+}
+
+func (d *deque[E]) popFront() E {
+	var zero E
+	e := d.items[d.head]
+	d.items[d.head] = zero
+	d.head++
+	if d.head == len(d.items) {
+		d.items = d.items[:0]
+		d.head = 0
+	} else if d.head >= 1024 && d.head*2 >= len(d.items) {
+		n := copy(d.items, d.items[d.head:])
+		clear(d.items[n:])
+		d.items = d.items[:n]
+		d.head = 0
+	}
+	return e
+}
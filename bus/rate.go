@@ -0,0 +1,133 @@
+package bus
+
+import (
+	"sync"
+	"time"
+)
+
+// The Subscribers returned by Batch, Debounce, Throttle and Sample share a
+// timer wheel with a resolution of 10ms, so durations are rounded up to
+// multiples of 10ms. They can be subscribed to any Bus. Messages that are
+// delivered by a timer are handed to the wrapped Subscriber from a separate
+// go-routine, panics in there are recovered and logged. Calls of the wrapped
+// Subscriber never overlap.
+
+// Edge selects when Debounce delivers a message.
+type Edge int
+
+const (
+	// TrailingEdge delivers the latest message once no message arrived for
+	// the wait duration.
+	TrailingEdge Edge = 1 << iota
+	// LeadingEdge delivers the first message right away and suppresses the
+	// following ones until no message arrived for the wait duration.
+	LeadingEdge
+)
+
+// Batch returns a Subscriber that collects messages and hands them to sub
+// as a batch once size messages were collected or interval passed since the
+// first message of the batch. A non-positive size or interval disables the
+// respective limit, at least one should be set.
+func Batch[E any](size int, interval time.Duration, sub func(batch []E)) Subscriber[E] {
+	mtx := &sync.Mutex{}
+	var batch []E
+	flush := func() {
+		if len(batch) > 0 {
+			b := batch
+			batch = nil
+			sub(b)
+		}
+	}
+	t := defaultWheel.newTimer(mtx, flush)
+	return func(msg E) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		batch = append(batch, msg)
+		if size > 0 && len(batch) >= size {
+			t.stop()
+			flush()
+		} else if len(batch) == 1 && interval > 0 {
+			t.reset(interval)
+		}
+	}
+}
+
+// Debounce returns a Subscriber that hands messages to sub only after no
+// message arrived for the wait duration. The edge determines which messages
+// are delivered, LeadingEdge|TrailingEdge delivers both the first and the
+// latest message of a burst.
+func Debounce[E any](wait time.Duration, edge Edge, sub Subscriber[E]) Subscriber[E] {
+	mtx := &sync.Mutex{}
+	var (
+		latest  E
+		pending bool // latest was not delivered yet
+		active  bool // a burst is in progress
+	)
+	t := defaultWheel.newTimer(mtx, func() {
+		active = false
+		if pending {
+			pending = false
+			sub(latest)
+		}
+	})
+	return func(msg E) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		t.reset(wait)
+		if !active && edge&LeadingEdge != 0 {
+			active = true
+			sub(msg)
+			return
+		}
+		active = true
+		if edge&TrailingEdge != 0 {
+			latest, pending = msg, true
+		}
+	}
+}
+
+// Throttle returns a Subscriber that hands at most one message per interval
+// to sub. Messages that arrive within the interval after a delivered message
+// are dropped.
+func Throttle[E any](interval time.Duration, sub Subscriber[E]) Subscriber[E] {
+	mtx := &sync.Mutex{}
+	blocked := false
+	t := defaultWheel.newTimer(mtx, func() {
+		blocked = false
+	})
+	return func(msg E) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if blocked {
+			return
+		}
+		blocked = true
+		t.reset(interval)
+		sub(msg)
+	}
+}
+
+// Sample returns a Subscriber that hands the latest message to sub once per
+// interval, but only if a message arrived within the interval.
+func Sample[E any](interval time.Duration, sub Subscriber[E]) Subscriber[E] {
+	mtx := &sync.Mutex{}
+	var (
+		latest  E
+		pending bool
+	)
+	t := defaultWheel.newTimer(mtx, func() {
+		if pending {
+			pending = false
+			sub(latest)
+		}
+	})
+	return func(msg E) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		latest = msg
+		if !pending {
+			pending = true
+			t.reset(interval)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package bus
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestBatchBySize(t *testing.T) {
+	b := NewBus[int]()
+	var batches [][]int
+	b.Subscribe(Batch(3, 0, func(batch []int) { batches = append(batches, batch) }))
+	for i := 0; i < 7; i++ {
+		b.Publish(i)
+	}
+	if fmt.Sprint(batches) != "[[0 1 2] [3 4 5]]" {
+		t.Fatalf("unexpected batches: %v", batches)
+	}
+}
+
+func TestBatchByInterval(t *testing.T) {
+	b := NewBus[int]()
+	batches := make(chan []int, 10)
+	b.Subscribe(Batch(100, 30*time.Millisecond, func(batch []int) { batches <- batch }))
+	b.Publish(1)
+	b.Publish(2)
+	select {
+	case batch := <-batches:
+		if fmt.Sprint(batch) != "[1 2]" {
+			t.Fatalf("unexpected batch: %v", batch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("batch was not flushed after the interval")
+	}
+}
+
+func TestDebounceTrailingEdge(t *testing.T) {
+	msgs := newRecorder[int]()
+	sub := Debounce(30*time.Millisecond, TrailingEdge, msgs.record)
+	for i := 0; i < 5; i++ {
+		sub(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := msgs.get(); fmt.Sprint(got) != "[4]" {
+		t.Fatalf("expected only the latest message, got %v", got)
+	}
+}
+
+func TestDebounceLeadingEdge(t *testing.T) {
+	msgs := newRecorder[int]()
+	sub := Debounce(30*time.Millisecond, LeadingEdge, msgs.record)
+	for i := 0; i < 5; i++ {
+		sub(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	sub(5) // a new burst
+	if got := msgs.get(); fmt.Sprint(got) != "[0 5]" {
+		t.Fatalf("expected the first message of every burst, got %v", got)
+	}
+}
+
+func TestDebounceBothEdges(t *testing.T) {
+	msgs := newRecorder[int]()
+	sub := Debounce(30*time.Millisecond, LeadingEdge|TrailingEdge, msgs.record)
+	for i := 0; i < 5; i++ {
+		sub(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := msgs.get(); fmt.Sprint(got) != "[0 4]" {
+		t.Fatalf("expected the first and the latest message, got %v", got)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	msgs := newRecorder[int]()
+	sub := Throttle(50*time.Millisecond, msgs.record)
+	for i := 0; i < 5; i++ {
+		sub(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	sub(5)
+	if got := msgs.get(); fmt.Sprint(got) != "[0 5]" {
+		t.Fatalf("unexpected messages: %v", got)
+	}
+}
+
+func TestSample(t *testing.T) {
+	msgs := newRecorder[int]()
+	sub := Sample(30*time.Millisecond, msgs.record)
+	for i := 0; i < 5; i++ {
+		sub(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := msgs.get(); fmt.Sprint(got) != "[4]" {
+		t.Fatalf("expected the latest message, got %v", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := msgs.get(); len(got) != 1 {
+		t.Fatalf("expected no delivery without new messages, got %v", got)
+	}
+}
+
+func TestTimerWheelFiresAfterFullRotations(t *testing.T) {
+	w := newTimerWheel(time.Millisecond, 4)
+	fired := make(chan time.Duration, 1)
+	start := time.Now()
+	w.newTimer(&sync.Mutex{}, func() { fired <- time.Since(start) }).reset(10 * time.Millisecond)
+	select {
+	case d := <-fired:
+		if d < 10*time.Millisecond {
+			t.Fatalf("timer fired too early after %v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire")
+	}
+}
+
+func TestTimerWheelStopAndReset(t *testing.T) {
+	w := newTimerWheel(time.Millisecond, 8)
+	var fired atomic.Int32
+	timer := w.newTimer(&sync.Mutex{}, func() { fired.Add(1) })
+	timer.reset(5 * time.Millisecond)
+	if !timer.stop() || timer.stop() {
+		t.Fatal("expected only the first stop to unschedule the timer")
+	}
+	timer.reset(5 * time.Millisecond)
+	timer.reset(20 * time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	if fired.Load() != 1 {
+		t.Fatalf("expected the timer to fire once, got %d", fired.Load())
+	}
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.count != 0 || w.running {
+		t.Fatal("expected the wheel to stop once idle")
+	}
+}
+
+func TestTimerWheelStopCancelsDueTimer(t *testing.T) {
+	w := newTimerWheel(time.Millisecond, 8)
+	mtx := &sync.Mutex{}
+	var fired atomic.Int32
+	timer := w.newTimer(mtx, func() { fired.Add(1) })
+	mtx.Lock()
+	timer.reset(time.Millisecond)
+	time.Sleep(20 * time.Millisecond) // the timer becomes due and waits for mtx
+	timer.stop()
+	mtx.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	if fired.Load() != 0 {
+		t.Fatal("expected the stopped timer not to fire")
+	}
+}
+
+type recorder[E any] struct {
+	mtx  *sync.Mutex
+	msgs []E
+}
+
+func newRecorder[E any]() *recorder[E] {
+	return &recorder[E]{mtx: &sync.Mutex{}}
+}
+
+func (r *recorder[E]) record(msg E) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.msgs = append(r.msgs, msg)
+}
+
+func (r *recorder[E]) get() []E {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]E(nil), r.msgs...)
+}
+
+/**
+ * Benchmarks
+ */
+func BenchmarkDebounce__10000_Subs(b *testing.B) {
+	subs := make([]Subscriber[int], 10000)
+	for i := range subs {
+		subs[i] = Debounce(time.Second, TrailingEdge, func(int) {})
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		subs[i%len(subs)](i)
+	}
+}
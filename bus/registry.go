@@ -0,0 +1,148 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// ErrTypeMismatch is returned if a named singleton is requested with a
+// different message type than it was created with.
+var ErrTypeMismatch = errors.New("named bus has a different message type")
+
+// NamedBusInfo describes a named singleton, see NamedBuses.
+type NamedBusInfo struct {
+	Name   string
+	Type   reflect.Type // type of the messages
+	Worker bool         // true for a WorkerBus
+}
+
+type registryKey struct {
+	name   string
+	worker bool
+}
+
+type registryEntry struct {
+	bus any
+	typ reflect.Type
+}
+
+var (
+	registryMtx = &sync.Mutex{}
+	registry    = map[registryKey]registryEntry{}
+)
+
+// GetNamedTypedBus - Provides thread-safe access to a Bus singleton with a
+// given name and message type. Repeated calls with the same name always return
+// the same Bus. Returns an error wrapping ErrTypeMismatch if the Bus was
+// created with a different message type, including by GetNamedBus.
+func GetNamedTypedBus[E any](name string) (Bus[E], error) {
+	return getNamed[E](registryKey{name: name}, func() Bus[E] {
+		return NewBus[E]()
+	})
+}
+
+// MustGetNamedTypedBus works like GetNamedTypedBus but panics on a type mismatch.
+func MustGetNamedTypedBus[E any](name string) Bus[E] {
+	return must(GetNamedTypedBus[E](name))
+}
+
+// GetNamedTypedWorkerBus - Provides thread-safe access to a WorkerBus singleton
+// with a given name and message type, see GetNamedTypedBus. The queue size is
+// WorkerBusSingletonQueueSize.
+func GetNamedTypedWorkerBus[E any](name string) (WorkerBus[E], error) {
+	return getNamed[E](registryKey{name: name, worker: true}, func() WorkerBus[E] {
+		return NewWorkerBus[E](WorkerBusSingletonQueueSize)
+	})
+}
+
+// MustGetNamedTypedWorkerBus works like GetNamedTypedWorkerBus but panics on a
+// type mismatch.
+func MustGetNamedTypedWorkerBus[E any](name string) WorkerBus[E] {
+	return must(GetNamedTypedWorkerBus[E](name))
+}
+
+// NamedBuses lists all named singletons ordered by name.
+func NamedBuses() []NamedBusInfo {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+	infos := make([]NamedBusInfo, 0, len(registry))
+	for key, entry := range registry {
+		infos = append(infos, NamedBusInfo{Name: key.name, Type: entry.typ, Worker: key.worker})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		return !infos[i].Worker
+	})
+	return infos
+}
+
+// RemoveNamedBus removes the Bus singleton with the given name. The next call
+// for that name creates a new Bus. Returns false if there was none.
+func RemoveNamedBus(name string) bool {
+	return removeNamed(registryKey{name: name})
+}
+
+// RemoveNamedWorkerBus removes the WorkerBus singleton with the given name and
+// closes it. Queued messages are still delivered, but RemoveNamedWorkerBus
+// returns without waiting for that. Returns false if there was none.
+func RemoveNamedWorkerBus(name string) bool {
+	return removeNamed(registryKey{name: name, worker: true})
+}
+
+// ResetNamedBuses removes all named singletons, e.g. to isolate tests. Removed
+// WorkerBus(es) are closed like with RemoveNamedWorkerBus.
+func ResetNamedBuses() {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+	for key, entry := range registry {
+		closeRemoved(entry)
+		delete(registry, key)
+	}
+}
+
+// getNamed returns the singleton registered for key or registers the one
+// returned by create. E is the message type of the singleton.
+func getNamed[E, B any](key registryKey, create func() B) (B, error) {
+	typ := reflect.TypeFor[E]()
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+	if entry, ok := registry[key]; ok {
+		if entry.typ == typ {
+			return entry.bus.(B), nil
+		}
+		var zero B
+		return zero, fmt.Errorf("%w: %q carries %v, requested %v", ErrTypeMismatch, key.name, entry.typ, typ)
+	}
+	b := create()
+	registry[key] = registryEntry{bus: b, typ: typ}
+	return b, nil
+}
+
+func removeNamed(key registryKey) bool {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+	entry, ok := registry[key]
+	if ok {
+		closeRemoved(entry)
+		delete(registry, key)
+	}
+	return ok
+}
+
+func closeRemoved(entry registryEntry) {
+	if c, ok := entry.bus.(interface{ Close() error }); ok {
+		go func() { _ = c.Close() }()
+	}
+}
+
+func must[B any](b B, err error) B {
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
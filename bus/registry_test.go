@@ -0,0 +1,116 @@
+package bus
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestGetNamedTypedBusReturnsSameBus(t *testing.T) {
+	b1, err := GetNamedTypedBus[int]("registry-same")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2 := MustGetNamedTypedBus[int]("registry-same")
+	if b1 != b2 {
+		t.Fatal("expected the same bus for the same name and type")
+	}
+	w1 := MustGetNamedTypedWorkerBus[int]("registry-same")
+	w2 := MustGetNamedTypedWorkerBus[int]("registry-same")
+	if w1 != w2 {
+		t.Fatal("expected the same worker bus for the same name and type")
+	}
+}
+
+func TestGetNamedTypedBusTypeMismatch(t *testing.T) {
+	MustGetNamedTypedBus[int]("registry-mismatch")
+	if _, err := GetNamedTypedBus[string]("registry-mismatch"); !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch, got %v", err)
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected GetNamedBus to panic on a type mismatch")
+		}
+	}()
+	GetNamedBus("registry-mismatch")
+}
+
+func TestGetNamedBusIsTypedAsAny(t *testing.T) {
+	b := GetNamedBus("registry-any")
+	if MustGetNamedTypedBus[any]("registry-any") != b {
+		t.Fatal("expected GetNamedBus to share the registry with GetNamedTypedBus[any]")
+	}
+}
+
+func TestNamedBusesListsRegisteredBuses(t *testing.T) {
+	MustGetNamedTypedBus[string]("registry-list")
+	MustGetNamedTypedWorkerBus[int]("registry-list")
+	var found []NamedBusInfo
+	for _, info := range NamedBuses() {
+		if info.Name == "registry-list" {
+			found = append(found, info)
+		}
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 entries, got %v", found)
+	}
+	if found[0].Worker || found[0].Type != reflect.TypeFor[string]() {
+		t.Fatalf("unexpected entry %+v", found[0])
+	}
+	if !found[1].Worker || found[1].Type != reflect.TypeFor[int]() {
+		t.Fatalf("unexpected entry %+v", found[1])
+	}
+}
+
+func TestRemoveNamedBus(t *testing.T) {
+	b := MustGetNamedTypedBus[int]("registry-remove")
+	if !RemoveNamedBus("registry-remove") {
+		t.Fatal("expected bus to be removed")
+	}
+	if RemoveNamedBus("registry-remove") {
+		t.Fatal("expected nothing to remove")
+	}
+	if MustGetNamedTypedBus[int]("registry-remove") == b {
+		t.Fatal("expected a new bus after removal")
+	}
+}
+
+func TestRemoveNamedWorkerBusClosesIt(t *testing.T) {
+	b := MustGetNamedTypedWorkerBus[int]("registry-remove-worker")
+	delivered := make(chan int, 1)
+	b.Subscribe(func(msg int) { delivered <- msg })
+	b.Publish(1)
+	if !RemoveNamedWorkerBus("registry-remove-worker") {
+		t.Fatal("expected worker bus to be removed")
+	}
+	select {
+	case <-b.(*workerBusImpl[int]).drained:
+	case <-time.After(time.Second):
+		t.Fatal("expected removed worker bus to be closed")
+	}
+	if b.PublishTimeout(2, 10*time.Millisecond) {
+		t.Fatal("expected removed worker bus to reject messages")
+	}
+	select {
+	case <-delivered:
+	default:
+		t.Fatal("expected the queued message to be delivered")
+	}
+}
+
+func TestResetNamedBuses(t *testing.T) {
+	MustGetNamedTypedBus[int]("registry-reset")
+	ResetNamedBuses()
+	for _, info := range NamedBuses() {
+		if info.Name == "registry-reset" {
+			t.Fatal("expected registry to be empty after reset")
+		}
+	}
+	if _, err := GetNamedTypedBus[string]("registry-reset"); err != nil {
+		t.Fatalf("expected name to be reusable with another type after reset, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A BehaviorBus is a Bus that remembers the latest message. Every new
+// Subscriber is immediately called with the latest message, if there is one.
+type BehaviorBus[E any] interface {
+	Bus[E]
+
+	// Latest returns the latest message that was published. Returns false if
+	// no message was published yet.
+	Latest() (msg E, ok bool)
+}
+
+type replayBusImpl[E any] struct {
+	mtx     *sync.Mutex // guards history and orders it with subscribing
+	bus     *busImpl[E]
+	history deque[timedMsg[E]]
+	size    int
+	window  time.Duration
+}
+
+type timedMsg[E any] struct {
+	msg E
+	at  time.Time
+}
+
+// NewReplayBus creates a Bus that replays recent messages to every new
+// Subscriber before it receives any newly published message. It keeps the
+// last size messages and only those published within window. A non-positive
+// size or window disables the respective limit, NewReplayBus panics if
+// neither is set, as the history would grow without bound. Like Bus, callers
+// of Publish directly invoke all Subscribers.
+func NewReplayBus[E any](size int, window time.Duration, opts ...BusOption[E]) Bus[E] {
+	if size <= 0 && window <= 0 {
+		panic("bus: NewReplayBus requires a positive size or window")
+	}
+	return newReplayBus(size, window, newOptions(opts, BusOption[E].applyBus))
+}
+
+// NewBehaviorBus creates a BehaviorBus. Like Bus, callers of Publish directly
+// invoke all Subscribers.
+func NewBehaviorBus[E any](opts ...BusOption[E]) BehaviorBus[E] {
+	return newReplayBus(1, 0, newOptions(opts, BusOption[E].applyBus))
+}
+
+func newReplayBus[E any](size int, window time.Duration, o options[E]) *replayBusImpl[E] {
+	return &replayBusImpl[E]{
+		mtx:    &sync.Mutex{},
+		bus:    newBus(o),
+		size:   size,
+		window: window,
+	}
+}
+
+func (b *replayBusImpl[E]) Publish(msg E) {
+	if len(b.bus.opts.publishInterceptors) > 0 {
+		b.bus.opts.interceptPublish(0, msg, b.publish)
+		return
+	}
+	b.publish(msg)
+}
+
+func (b *replayBusImpl[E]) publish(msg E) {
+	b.mtx.Lock()
+	b.history.pushBack(timedMsg[E]{msg: msg, at: time.Now()})
+	b.prune()
+	subs := *b.bus.subs.Load() // Subscribers that subscribe later replay msg
+	b.mtx.Unlock()
+	b.bus.publishTo(context.Background(), subs, msg)
+}
+
+func (b *replayBusImpl[E]) Subscribe(sub Subscriber[E]) (unsubscribe func()) {
+	g := &replayGate[E]{mtx: &sync.Mutex{}, replaying: true}
+	b.mtx.Lock()
+	b.prune()
+	history := make([]E, 0, b.history.len())
+	for _, m := range b.history.items[b.history.head:] {
+		history = append(history, m.msg)
+	}
+	s := b.bus.subscribe(sub, nil, g.admit) // held back messages are neither intercepted nor counted yet
+	b.mtx.Unlock()
+
+	// replay without holding the lock, so sub may publish or subscribe
+	for _, msg := range history {
+		b.bus.opts.deliver(s.id, sub, msg, &s.delivered)
+	}
+	for {
+		pending := g.finishReplay()
+		if len(pending) == 0 {
+			break
+		}
+		for _, msg := range pending {
+			b.bus.opts.deliver(s.id, sub, msg, &s.delivered)
+		}
+	}
+	return b.bus.unsubscribeId(s.id)
+}
+
+func (b *replayBusImpl[E]) Stats() Stats {
+	return b.bus.Stats()
+}
+
+func (b *replayBusImpl[E]) Latest() (msg E, ok bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.prune()
+	if b.history.len() == 0 {
+		return msg, false
+	}
+	return b.history.items[len(b.history.items)-1].msg, true
+}
+
+// prune removes messages that exceed the size or are older than the window.
+// Must be called with the lock held.
+func (b *replayBusImpl[E]) prune() {
+	for b.size > 0 && b.history.len() > b.size {
+		b.history.popFront()
+	}
+	if b.window > 0 {
+		minTime := time.Now().Add(-b.window)
+		for b.history.len() > 0 && b.history.items[b.history.head].at.Before(minTime) {
+			b.history.popFront()
+		}
+	}
+}
+
+// replayGate holds back messages that are published while the history is
+// replayed to a new Subscriber, so that it receives all messages in order.
+type replayGate[E any] struct {
+	mtx       *sync.Mutex
+	replaying bool
+	pending   []E
+}
+
+// admit reports whether msg is delivered right away, otherwise it is held
+// back until the replay finished.
+func (g *replayGate[E]) admit(msg E) bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.replaying {
+		g.pending = append(g.pending, msg)
+		return false
+	}
+	return true
+}
+
+// finishReplay returns the messages that were held back. Once there are none,
+// the gate opens and messages are passed through.
+func (g *replayGate[E]) finishReplay() (pending []E) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	pending, g.pending = g.pending, nil
+	if len(pending) == 0 {
+		g.replaying = false
+	}
+	return pending
+}
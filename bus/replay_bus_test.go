@@ -0,0 +1,108 @@
+package bus
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestReplayBusReplaysLastMessages(t *testing.T) {
+	b := NewReplayBus[int](3, 0)
+	for i := 0; i < 5; i++ {
+		b.Publish(i)
+	}
+	var msgs []int
+	b.Subscribe(func(msg int) { msgs = append(msgs, msg) })
+	b.Publish(5)
+	if fmt.Sprint(msgs) != "[2 3 4 5]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestReplayBusReplaysMessagesWithinWindow(t *testing.T) {
+	b := NewReplayBus[int](0, 30*time.Millisecond)
+	b.Publish(0)
+	b.Publish(1)
+	time.Sleep(50 * time.Millisecond)
+	b.Publish(2)
+	var msgs []int
+	b.Subscribe(func(msg int) { msgs = append(msgs, msg) })
+	if fmt.Sprint(msgs) != "[2]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestReplayBusRequiresALimit(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewReplayBus without size and window to panic")
+		}
+	}()
+	NewReplayBus[int](0, 0)
+}
+
+func TestReplayBusPublishDuringReplayIsDeliveredInOrder(t *testing.T) {
+	b := NewReplayBus[int](10, 0)
+	b.Publish(0)
+	b.Publish(1)
+	var msgs []int
+	b.Subscribe(func(msg int) {
+		msgs = append(msgs, msg)
+		if msg == 0 {
+			b.Publish(2) // must not deadlock and must arrive after the replay
+		}
+	})
+	if fmt.Sprint(msgs) != "[0 1 2]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestReplayBusUnsubscribe(t *testing.T) {
+	b := NewReplayBus[int](10, 0)
+	b.Publish(0)
+	count := 0
+	unsubscribe := b.Subscribe(func(int) { count++ })
+	unsubscribe()
+	b.Publish(1)
+	if count != 1 {
+		t.Fatalf("expected 1 delivery, got %d", count)
+	}
+}
+
+func TestBehaviorBusDeliversLatestOnSubscribe(t *testing.T) {
+	b := NewBehaviorBus[string]()
+	if _, ok := b.Latest(); ok {
+		t.Fatal("expected no latest message on a new bus")
+	}
+	var msgs []string
+	b.Subscribe(func(msg string) { msgs = append(msgs, msg) })
+	if len(msgs) != 0 {
+		t.Fatalf("expected no replay on a new bus, got %v", msgs)
+	}
+	b.Publish("loading")
+	b.Publish("ready")
+	var late []string
+	b.Subscribe(func(msg string) { late = append(late, msg) })
+	if fmt.Sprint(late) != "[ready]" {
+		t.Fatalf("expected late subscriber to receive the latest state, got %v", late)
+	}
+	if latest, ok := b.Latest(); !ok || latest != "ready" {
+		t.Fatalf("expected latest message \"ready\", got %q", latest)
+	}
+	if fmt.Sprint(msgs) != "[loading ready]" {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestBehaviorBusRecoversPanicDuringReplay(t *testing.T) {
+	panics := 0
+	b := NewBehaviorBus[int](WithPanicHandler(func(int, int64, any, []byte) { panics++ }))
+	b.Publish(1)
+	b.Subscribe(func(int) { panic("boom") })
+	if panics != 1 {
+		t.Fatalf("expected the panic during replay to be recovered, got %d panics", panics)
+	}
+}
@@ -0,0 +1,120 @@
+package bus
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotEnoughReplies is returned by Requester.RequestN if the context ends
+// before the requested number of replies was gathered.
+var ErrNotEnoughReplies = errors.New("not enough replies")
+
+// A Request is published on the Bus of a Requester. Subscribers answer it by
+// calling Reply.
+type Request[Req, Resp any] struct {
+	// Ctx is the context of the caller. Responders may use it to abort work
+	// once the caller has stopped waiting.
+	Ctx context.Context
+	// Msg is the message the caller requested an answer for.
+	Msg     Req
+	replies chan Resp
+}
+
+// Reply answers the Request. Returns false if the reply was not accepted,
+// either because the caller stopped waiting or because it already gathered
+// enough replies.
+func (r Request[Req, Resp]) Reply(resp Resp) bool {
+	if r.Ctx.Err() != nil {
+		return false
+	}
+	select {
+	case r.replies <- resp:
+		return true
+	default:
+		return false
+	}
+}
+
+// A Responder answers a request. If ok is false, the Responder does not reply.
+type Responder[Req, Resp any] func(ctx context.Context, req Req) (resp Resp, ok bool)
+
+// A Requester implements a request/reply pattern on top of a Bus. Requests
+// are published on the Bus and every Subscriber may reply to them.
+type Requester[Req, Resp any] interface {
+	// Request publishes msg and returns the first reply. If the context ends
+	// before a reply arrives, the context's error is returned.
+	Request(ctx context.Context, msg Req) (Resp, error)
+
+	// RequestN publishes msg and gathers up to n replies (scatter-gather).
+	// If the context ends before n replies arrived, the replies gathered so
+	// far are returned together with an error wrapping ErrNotEnoughReplies
+	// and the context's error.
+	RequestN(ctx context.Context, msg Req, n int) ([]Resp, error)
+
+	// Respond subscribes a Responder that answers all future requests. The
+	// returned function unsubscribes the Responder.
+	Respond(responder Responder[Req, Resp]) (unsubscribe func())
+}
+
+type requesterImpl[Req, Resp any] struct {
+	b Bus[Request[Req, Resp]]
+}
+
+// NewRequester creates a Requester that publishes requests on the given Bus.
+// With a Bus, Responders are called by the goroutine that invokes Request,
+// with a WorkerBus they run on the WorkerBus' go-routines.
+func NewRequester[Req, Resp any](b Bus[Request[Req, Resp]]) Requester[Req, Resp] {
+	return &requesterImpl[Req, Resp]{b: b}
+}
+
+func (r *requesterImpl[Req, Resp]) Request(ctx context.Context, msg Req) (resp Resp, err error) {
+	if err = ctx.Err(); err != nil {
+		return resp, err
+	}
+	replies := r.publish(ctx, msg, 1)
+	select {
+	case resp = <-replies:
+		return resp, nil
+	case <-ctx.Done():
+		return resp, ctx.Err()
+	}
+}
+
+func (r *requesterImpl[Req, Resp]) RequestN(ctx context.Context, msg Req, n int) ([]Resp, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	replies := r.publish(ctx, msg, n)
+	resps := make([]Resp, 0, n)
+	for len(resps) < n {
+		select {
+		case resp := <-replies:
+			resps = append(resps, resp)
+		case <-ctx.Done():
+			return resps, errors.Join(ErrNotEnoughReplies, ctx.Err())
+		}
+	}
+	return resps, nil
+}
+
+func (r *requesterImpl[Req, Resp]) Respond(responder Responder[Req, Resp]) (unsubscribe func()) {
+	return r.b.Subscribe(func(req Request[Req, Resp]) {
+		if req.Ctx.Err() != nil {
+			return // caller is not waiting anymore
+		}
+		if resp, ok := responder(req.Ctx, req.Msg); ok {
+			req.Reply(resp)
+		}
+	})
+}
+
+// publish publishes a Request whose reply channel can hold n replies, so
+// replying never blocks a Responder.
+func (r *requesterImpl[Req, Resp]) publish(ctx context.Context, msg Req, n int) chan Resp {
+	replies := make(chan Resp, n)
+	r.b.Publish(Request[Req, Resp]{Ctx: ctx, Msg: msg, replies: replies})
+	return replies
+}
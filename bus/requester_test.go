@@ -0,0 +1,87 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestRequesterRequestReturnsFirstReply(t *testing.T) {
+	r := NewRequester[int, int](NewBus[Request[int, int]]())
+	r.Respond(func(_ context.Context, req int) (int, bool) { return req * 2, true })
+	r.Respond(func(_ context.Context, req int) (int, bool) { return req * 3, true })
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	resp, err := r.Request(ctx, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != 42 {
+		t.Fatalf("expected first reply 42, got %d", resp)
+	}
+}
+
+func TestRequesterRequestTimesOutWithoutReply(t *testing.T) {
+	r := NewRequester[int, int](NewWorkerBus[Request[int, int]](10))
+	r.Respond(func(context.Context, int) (int, bool) { return 0, false })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := r.Request(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRequesterRequestNGathersReplies(t *testing.T) {
+	r := NewRequester[string, int](NewWorkerBus[Request[string, int]](10))
+	for i := 0; i < 5; i++ {
+		r.Respond(func(context.Context, string) (int, bool) { return i, true })
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	resps, err := r.RequestN(ctx, "who?", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != 3 {
+		t.Fatalf("expected 3 replies, got %d", len(resps))
+	}
+}
+
+func TestRequesterRequestNReturnsPartialRepliesOnDeadline(t *testing.T) {
+	r := NewRequester[string, int](NewBus[Request[string, int]]())
+	r.Respond(func(context.Context, string) (int, bool) { return 1, true })
+	r.Respond(func(context.Context, string) (int, bool) { return 2, true })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resps, err := r.RequestN(ctx, "who?", 3)
+	if !errors.Is(err, ErrNotEnoughReplies) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ErrNotEnoughReplies and context.DeadlineExceeded, got %v", err)
+	}
+	if len(resps) != 2 {
+		t.Fatalf("expected 2 partial replies, got %d", len(resps))
+	}
+}
+
+func TestRequesterUnsubscribedResponderDoesNotReply(t *testing.T) {
+	r := NewRequester[int, int](NewBus[Request[int, int]]())
+	unsubscribe := r.Respond(func(context.Context, int) (int, bool) { return 1, true })
+	unsubscribe()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.Request(ctx, 1); err == nil {
+		t.Fatal("expected error, responder was unsubscribed")
+	}
+}
+
+func TestRequestReplyAfterCancelIsRejected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := Request[int, int]{Ctx: ctx, Msg: 1, replies: make(chan int, 1)}
+	cancel()
+	if req.Reply(1) {
+		t.Fatal("expected Reply to return false after the caller cancelled")
+	}
+}
@@ -0,0 +1,119 @@
+package bus
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// An ErrorSubscriber is called with messages that are published on a
+// WorkerBus. Returning nil acknowledges the message, returning an error lets
+// the WorkerBus retry it according to the RetryPolicy of the Subscriber.
+type ErrorSubscriber[E any] func(msg E) error
+
+// A RetryPolicy determines how often and when a failed message is retried.
+// The n-th retry waits InitialBackoff * Multiplier^(n-1), at most MaxBackoff,
+// randomly varied by +/- Jitter (a fraction between 0 and 1) of that time.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a message is handed to the Subscriber
+	// including the first attempt. Values lower than 1 are treated as 1.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+}
+
+// DefaultRetryPolicy is used by SubscribeWithRetry unless WithRetryPolicy is given.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// backoff returns the time to wait after the given failed attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= max(p.Multiplier, 1)
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(max(d, 0))
+}
+
+// A Failure describes a single failed attempt to handle a message.
+type Failure struct {
+	Attempt int
+	At      time.Time
+	Err     error
+}
+
+// A DeadLetter is a message that could not be handled by an ErrorSubscriber
+// within the attempts of its RetryPolicy.
+type DeadLetter[E any] struct {
+	Msg      E
+	Failures []Failure
+}
+
+// retrying returns a Subscriber that hands messages to sub until sub succeeds
+// or the attempts of p are exhausted, in which case the message is published
+// on deadLetters. Retries block the Subscriber's worker, so the order of
+// messages is kept. Once closing or stopping is closed, the backoff is cut
+// short and the message is given up on right away.
+func retrying[E any](sub ErrorSubscriber[E], p RetryPolicy, deadLetters Bus[DeadLetter[E]], closing, stopping <-chan struct{}) Subscriber[E] {
+	return func(msg E) {
+		var failures []Failure
+		for attempt := 1; ; attempt++ {
+			err := callErrorSubscriber(sub, msg)
+			if err == nil {
+				return
+			}
+			failures = append(failures, Failure{Attempt: attempt, At: time.Now(), Err: err})
+			if attempt >= p.MaxAttempts || !awaitBackoff(p.backoff(attempt), closing, stopping) {
+				break
+			}
+		}
+		if deadLetters != nil {
+			deadLetters.Publish(DeadLetter[E]{Msg: msg, Failures: failures})
+		} else {
+			log.Printf("bus: gave up on %v after %d attempts: %v", msg, len(failures), failures[len(failures)-1].Err)
+		}
+	}
+}
+
+// awaitBackoff waits for d. Returns false if closing or stopping was closed
+// before.
+func awaitBackoff(d time.Duration, closing, stopping <-chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-closing:
+		return false
+	case <-stopping:
+		return false
+	}
+}
+
+// callErrorSubscriber calls sub and turns a panic into an error, so that it
+// is retried like any other failure.
+func callErrorSubscriber[E any](sub ErrorSubscriber[E], msg E) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("subscriber panicked: %v", r)
+		}
+	}()
+	return sub(msg)
+}
@@ -0,0 +1,153 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+var fastRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	Multiplier:     2,
+}
+
+func TestWorkerBusRetriesUntilSuccess(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	var attempts atomic.Int32
+	b.SubscribeWithRetry(func(int) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, WithRetryPolicy[int](fastRetryPolicy))
+	b.Publish(1)
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if attempts.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestWorkerBusExhaustedRetriesGoToDeadLetters(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	deadLetters := NewBus[DeadLetter[int]]()
+	var dead []DeadLetter[int]
+	deadLetters.Subscribe(func(l DeadLetter[int]) { dead = append(dead, l) })
+	b.SubscribeWithRetry(func(msg int) error {
+		if msg%2 == 1 {
+			return fmt.Errorf("odd: %d", msg)
+		}
+		return nil
+	}, WithRetryPolicy[int](fastRetryPolicy), WithDeadLetters(deadLetters))
+	for i := 0; i < 4; i++ {
+		b.Publish(i)
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 2 || dead[0].Msg != 1 || dead[1].Msg != 3 {
+		t.Fatalf("unexpected dead letters: %v", dead)
+	}
+	for _, l := range dead {
+		if len(l.Failures) != 3 {
+			t.Fatalf("expected 3 failures, got %v", l.Failures)
+		}
+		for i, f := range l.Failures {
+			if f.Attempt != i+1 || f.Err == nil {
+				t.Fatalf("unexpected failure history: %v", l.Failures)
+			}
+		}
+	}
+}
+
+func TestWorkerBusRetryTreatsPanicAsFailure(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	var attempts atomic.Int32
+	b.SubscribeWithRetry(func(int) error {
+		if attempts.Add(1) == 1 {
+			panic("boom")
+		}
+		return nil
+	}, WithRetryPolicy[int](fastRetryPolicy))
+	b.Publish(1)
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if attempts.Load() != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestWorkerBusCloseInterruptsRetries(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	deadLetters := NewBus[DeadLetter[int]]()
+	var dead []DeadLetter[int]
+	deadLetters.Subscribe(func(l DeadLetter[int]) { dead = append(dead, l) })
+	b.SubscribeWithRetry(func(int) error {
+		return errors.New("failed")
+	}, WithRetryPolicy[int](RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}), WithDeadLetters(deadLetters))
+	b.Publish(1)
+	b.Publish(2)
+	start := time.Now()
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Close waited %v for the backoff", d)
+	}
+	if len(dead) != 2 || len(dead[0].Failures) != 1 || len(dead[1].Failures) != 1 {
+		t.Fatalf("expected both messages to be given up on after one attempt, got %v", dead)
+	}
+}
+
+func TestWorkerBusUnsubscribeInterruptsRetries(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	defer func() { _ = b.Close() }()
+	failed := make(chan struct{}, 1)
+	s := b.SubscribeWithRetry(func(int) error {
+		failed <- struct{}{}
+		return errors.New("failed")
+	}, WithRetryPolicy[int](RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}))
+	b.Publish(1)
+	<-failed
+	s.Unsubscribe()
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe did not interrupt the backoff")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 2}
+	expected := []time.Duration{10, 20, 40, 50, 50}
+	for i, e := range expected {
+		if d := p.backoff(i + 1); d != e*time.Millisecond {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, e*time.Millisecond, d)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(1); d < 5*time.Millisecond || d > 15*time.Millisecond {
+			t.Fatalf("backoff with jitter out of range: %v", d)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package bus
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// A Scheduled is a message that is going to be published by a WorkerBus, see
+// WorkerBus.PublishAfter and WorkerBus.PublishAt.
+type Scheduled interface {
+	// Cancel prevents the message from being published. Returns false if it
+	// was already published or cancelled.
+	Cancel() bool
+
+	// At returns the time the message is due to be published at.
+	At() time.Time
+}
+
+// WithScheduleFile lets a WorkerBus persist the messages scheduled with
+// PublishAfter and PublishAt to the given file, encoded with the Codec set by
+// WithCodec. The file is rewritten whenever a message is scheduled, cancelled
+// or published, so it suits moderate numbers of pending messages. A new
+// WorkerBus restores the pending messages from the file, they are published
+// once the first Subscriber subscribed, right away if they are overdue. Until
+// then, messages scheduled on a WorkerBus with restored messages are held
+// back as well.
+func WithScheduleFile[E any](path string) WorkerBusOption[E] {
+	return workerBusOption[E](func(o *options[E]) {
+		o.scheduleFile = path
+	})
+}
+
+// scheduler publishes messages on a WorkerBus once they are due. Pending
+// messages are kept in a heap ordered by due time, a single go-routine waits
+// for the earliest one.
+type scheduler[E any] struct {
+	b         *workerBusImpl[E]
+	mtx       *sync.Mutex
+	pending   scheduleHeap[E]
+	wake      chan struct{} // signalled when the earliest message changed
+	startOnce *sync.Once
+	running   *sync.WaitGroup // run, waited for by the WorkerBus on shutdown
+	restored  bool            // messages were restored, run waits for the first Subscriber
+}
+
+type scheduledMsg[E any] struct {
+	s     *scheduler[E]
+	at    time.Time
+	msg   E
+	data  []byte // encoded msg, only if the schedule is persisted
+	index int    // in the heap, -1 once published or cancelled
+}
+
+func newScheduler[E any](b *workerBusImpl[E]) *scheduler[E] {
+	s := &scheduler[E]{
+		b:         b,
+		mtx:       &sync.Mutex{},
+		wake:      make(chan struct{}, 1),
+		startOnce: &sync.Once{},
+		running:   &sync.WaitGroup{},
+	}
+	if b.opts.scheduleFile != "" {
+		if err := s.restore(); err != nil {
+			log.Printf("bus: failed to restore scheduled messages from %s: %v", b.opts.scheduleFile, err)
+		}
+		s.restored = len(s.pending) > 0
+	}
+	return s
+}
+
+// start starts the go-routine of the scheduler unless it is already running.
+func (s *scheduler[E]) start() {
+	s.startOnce.Do(func() {
+		s.running.Add(1)
+		go s.run()
+	})
+}
+
+func (s *scheduler[E]) schedule(msg E, at time.Time) Scheduled {
+	m := &scheduledMsg[E]{s: s, at: at, msg: msg, index: -1}
+	if s.b.opts.scheduleFile != "" {
+		data, err := s.b.opts.codec.Encode(msg)
+		if err != nil {
+			log.Printf("bus: failed to encode scheduled message: %v", err)
+			return m
+		}
+		m.data = data
+	}
+	s.b.closeMtx.RLock()
+	defer s.b.closeMtx.RUnlock()
+	if s.b.closed {
+		return m // never published
+	}
+	s.mtx.Lock()
+	heap.Push(&s.pending, m)
+	s.persist()
+	s.mtx.Unlock()
+	notify(s.wake)
+	if !s.restored { // restored messages must not be published to nobody
+		s.start()
+	}
+	return m
+}
+
+func (m *scheduledMsg[E]) Cancel() bool {
+	s := m.s
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if m.index < 0 {
+		return false
+	}
+	heap.Remove(&s.pending, m.index)
+	s.persist()
+	return true
+}
+
+func (m *scheduledMsg[E]) At() time.Time {
+	return m.at
+}
+
+// run publishes due messages until the WorkerBus is closed. Messages that
+// were due but could not be published anymore are kept pending.
+func (s *scheduler[E]) run() {
+	defer s.running.Done()
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-s.wake:
+		case <-s.b.closing:
+			return
+		}
+		s.mtx.Lock()
+		var due []*scheduledMsg[E]
+		for len(s.pending) > 0 && !s.pending[0].at.After(time.Now()) {
+			due = append(due, heap.Pop(&s.pending).(*scheduledMsg[E]))
+		}
+		s.mtx.Unlock()
+
+		// publish before persisting, so that no message is lost on a crash
+		published := 0
+		for _, m := range due {
+			if s.b.publish(context.Background(), m.msg, PriorityNormal, nil) != nil {
+				break // closed, the rest is kept in the schedule file
+			}
+			published++
+		}
+
+		s.mtx.Lock()
+		for _, m := range due[published:] {
+			heap.Push(&s.pending, m)
+		}
+		if len(due) > 0 {
+			s.persist()
+		}
+		if published < len(due) {
+			s.mtx.Unlock()
+			return
+		}
+		t.Stop()
+		if len(s.pending) > 0 {
+			t.Reset(time.Until(s.pending[0].at))
+		}
+		s.mtx.Unlock()
+	}
+}
+
+// persist writes all pending messages to the schedule file. Must be called
+// with mtx held.
+func (s *scheduler[E]) persist() {
+	path := s.b.opts.scheduleFile
+	if path == "" {
+		return
+	}
+	if err := s.write(path); err != nil {
+		log.Printf("bus: failed to persist scheduled messages to %s: %v", path, err)
+	}
+}
+
+// write replaces the file at path with the pending messages. Every message is
+// stored as its due time (8 bytes, unix nanoseconds), the length of its
+// encoding (4 bytes) and its encoding, all big endian.
+func (s *scheduler[E]) write(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	var hdr [12]byte
+	for _, m := range s.pending {
+		binary.BigEndian.PutUint64(hdr[:8], uint64(m.at.UnixNano()))
+		binary.BigEndian.PutUint32(hdr[8:], uint32(len(m.data)))
+		_, _ = w.Write(hdr[:])
+		_, _ = w.Write(m.data)
+	}
+	err = w.Flush()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restore reads the pending messages from the schedule file.
+func (s *scheduler[E]) restore() error {
+	f, err := os.Open(s.b.opts.scheduleFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	r := bufio.NewReader(f)
+	var hdr [12]byte
+	for {
+		if _, err = io.ReadFull(r, hdr[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		data := make([]byte, binary.BigEndian.Uint32(hdr[8:]))
+		if _, err = io.ReadFull(r, data); err != nil {
+			return err
+		}
+		msg, err := s.b.opts.codec.Decode(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode scheduled message: %w", err)
+		}
+		at := time.Unix(0, int64(binary.BigEndian.Uint64(hdr[:8])))
+		heap.Push(&s.pending, &scheduledMsg[E]{s: s, at: at, msg: msg, data: data})
+	}
+}
+
+// scheduleHeap implements heap.Interface, the earliest message comes first.
+type scheduleHeap[E any] []*scheduledMsg[E]
+
+func (h scheduleHeap[E]) Len() int {
+	return len(h)
+}
+
+func (h scheduleHeap[E]) Less(i, j int) bool {
+	return h[i].at.Before(h[j].at)
+}
+
+func (h scheduleHeap[E]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduleHeap[E]) Push(x any) {
+	m := x.(*scheduledMsg[E])
+	m.index = len(*h)
+	*h = append(*h, m)
+}
+
+func (h *scheduleHeap[E]) Pop() any {
+	old := *h
+	m := old[len(old)-1]
+	old[len(old)-1] = nil
+	m.index = -1
+	*h = old[:len(old)-1]
+	return m
+}
@@ -0,0 +1,186 @@
+package bus
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestWorkerBusPublishAfter(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	defer func() { _ = b.Close() }()
+	received := make(chan int, 10)
+	b.Subscribe(func(msg int) { received <- msg })
+	start := time.Now()
+	b.PublishAfter(2, 40*time.Millisecond)
+	b.PublishAfter(1, 20*time.Millisecond)
+	b.PublishAt(0, start)
+	for i := 0; i < 3; i++ {
+		expectMsg(t, received, i)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Fatalf("messages were published too early after %v", d)
+	}
+}
+
+func TestWorkerBusCancelScheduled(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	defer func() { _ = b.Close() }()
+	received := make(chan int, 10)
+	b.Subscribe(func(msg int) { received <- msg })
+	s := b.PublishAfter(1, 20*time.Millisecond)
+	b.PublishAfter(2, 30*time.Millisecond)
+	if !s.Cancel() || s.Cancel() {
+		t.Fatal("expected only the first Cancel to succeed")
+	}
+	expectMsg(t, received, 2)
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message %d", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestWorkerBusScheduledAfterClose(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	count := 0
+	b.Subscribe(func(int) { count++ })
+	b.PublishAfter(1, time.Hour)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.PublishAfter(2, 0); s.Cancel() {
+		t.Fatal("expected message scheduled after Close to be discarded")
+	}
+	if count != 0 {
+		t.Fatalf("expected no deliveries, got %d", count)
+	}
+}
+
+func TestWorkerBusRestoresScheduledMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule")
+	b := NewWorkerBus[string](10, WithScheduleFile[string](path))
+	due := time.Now().Add(50 * time.Millisecond)
+	b.PublishAt("later", due.Add(20*time.Millisecond))
+	b.PublishAt("soon", due)
+	b.PublishAt("cancelled", due).Cancel()
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b = NewWorkerBus[string](10, WithScheduleFile[string](path))
+	defer func() { _ = b.Close() }()
+	time.Sleep(100 * time.Millisecond) // messages must wait for the first Subscriber
+	received := make(chan string, 10)
+	b.Subscribe(func(msg string) { received <- msg })
+	expectMsg(t, received, "soon")
+	expectMsg(t, received, "later")
+
+	for i := 0; ; i++ {
+		if fi, err := os.Stat(path); err == nil && fi.Size() == 0 {
+			break
+		} else if i > 100 {
+			t.Fatal("expected published messages to be removed from the file")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkerBusHoldsRestoredMessagesWhenScheduling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule")
+	b := NewWorkerBus[string](10, WithScheduleFile[string](path))
+	b.PublishAfter("restored", 10*time.Millisecond)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	b = NewWorkerBus[string](10, WithScheduleFile[string](path))
+	defer func() { _ = b.Close() }()
+	b.PublishAfter("new", 0) // must not publish the overdue restored message to nobody
+	time.Sleep(50 * time.Millisecond)
+	received := make(chan string, 10)
+	b.Subscribe(func(msg string) { received <- msg })
+	expectMsg(t, received, "restored")
+	expectMsg(t, received, "new")
+}
+
+func TestWorkerBusRestoresScheduledMessagesForGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule")
+	b := NewWorkerBus[string](10, WithScheduleFile[string](path))
+	b.PublishAfter("restored", 10*time.Millisecond)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b = NewWorkerBus[string](10, WithScheduleFile[string](path))
+	defer func() { _ = b.Close() }()
+	received := make(chan string, 10)
+	b.SubscribeGroup("workers", func(msg string) { received <- msg })
+	expectMsg(t, received, "restored")
+}
+
+func TestWorkerBusKeepsScheduledMessagesThatCouldNotBePublished(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule")
+	b := NewWorkerBus[int](1, WithScheduleFile[int](path))
+	release := make(chan struct{})
+	_, received := blockedSubscriber(t, b, release)
+	for i := 0; i < 10; i++ {
+		b.PublishAfter(i, 0)
+	}
+	time.Sleep(20 * time.Millisecond) // the scheduler blocks on the full queue
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Drain(ctx); err == nil {
+		t.Fatal("expected Drain to time out")
+	}
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(received)
+	seen := map[int]bool{}
+	for msg := range received {
+		seen[msg] = true
+	}
+
+	b = NewWorkerBus[int](10, WithScheduleFile[int](path))
+	defer func() { _ = b.Close() }()
+	restored := make(chan int, 10)
+	b.Subscribe(func(msg int) { restored <- msg })
+	for i := 0; i < 10; i++ {
+		if seen[i] {
+			continue
+		}
+		select {
+		case msg := <-restored:
+			if seen[msg] {
+				t.Fatalf("message %d was delivered twice", msg)
+			}
+			seen[msg] = true
+		case <-time.After(time.Second):
+			t.Fatalf("message %d was lost", i)
+		}
+	}
+}
+
+/**
+ * Benchmarks
+ */
+func BenchmarkWorkerBusPublishAfter__10000_Pending(b *testing.B) {
+	bu := NewWorkerBus[int](10)
+	defer func() { _ = bu.Close() }()
+	for i := 0; i < 10000; i++ {
+		bu.PublishAfter(i, time.Hour+time.Duration(i)*time.Millisecond)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bu.PublishAfter(i, time.Hour).Cancel()
+	}
+}
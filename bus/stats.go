@@ -0,0 +1,181 @@
+package bus
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// An Inspector reports the Stats of a bus. A Bus, ReplayBus, BehaviorBus,
+// WorkerBus and the RemoteBus returned by DialBus implement it.
+type Inspector interface {
+	Stats() Stats
+}
+
+// Stats is a snapshot of the counters of a bus, see Inspector.
+type Stats struct {
+	Subscribers int
+	Published   uint64 // messages passed on to the Subscribers, or queued by a WorkerBus
+	Delivered   uint64 // messages handed to a Subscriber, counted once per Subscriber
+	Dropped     uint64 // messages discarded by the OverflowPolicy of a Subscriber
+	Queued      int    // messages in the queue of a WorkerBus, not yet handed to its Subscribers
+
+	Subscriptions []SubscriberStats
+}
+
+// SubscriberStats are the counters of a single Subscriber, see Stats.
+type SubscriberStats struct {
+	Id        int64
+	Delivered uint64
+	Dropped   uint64
+	Panics    int64
+	Queued    int               // messages in the queues of the Subscriber of a WorkerBus
+	Latency   *LatencyHistogram // nil unless WithLatencyStats is set
+}
+
+// latencyBounds are the upper bounds of the buckets of a LatencyHistogram.
+var latencyBounds = []time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// A LatencyHistogram counts how long a Subscriber took to handle messages.
+// Counts[i] is the number of messages that took at most Bounds[i], but
+// longer than the previous bound. The last count holds the messages that
+// took longer than all bounds. Bounds is shared and must not be modified.
+type LatencyHistogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Sum    time.Duration
+}
+
+// Count returns the number of messages in the histogram.
+func (h *LatencyHistogram) Count() (n uint64) {
+	for _, c := range h.Counts {
+		n += c
+	}
+	return n
+}
+
+// Mean returns the average time a message took or 0 if there were none.
+func (h *LatencyHistogram) Mean() time.Duration {
+	n := h.Count()
+	if n == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(n)
+}
+
+// Quantile returns the upper bound of the bucket that contains the q-th
+// quantile, e.g. 0.99. Messages that took longer than all bounds report
+// the largest bound.
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	n := h.Count()
+	if n == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(n))
+	var seen uint64
+	for i, c := range h.Counts[:len(h.Bounds)] {
+		seen += c
+		if seen > rank {
+			return h.Bounds[i]
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// WithLatencyStats records how long every Subscriber takes to handle a
+// message, see SubscriberStats.Latency. Measuring costs two clock reads per
+// delivered message.
+func WithLatencyStats[E any]() StatsOption[E] {
+	return func(o *options[E]) {
+		o.latencyStats = true
+	}
+}
+
+// latencyRecorder is the concurrently updated form of a LatencyHistogram.
+type latencyRecorder struct {
+	counts []atomic.Uint64
+	sum    atomic.Int64
+}
+
+func newLatencyRecorder(enabled bool) *latencyRecorder {
+	if !enabled {
+		return nil
+	}
+	return &latencyRecorder{counts: make([]atomic.Uint64, len(latencyBounds)+1)}
+}
+
+func (r *latencyRecorder) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	r.counts[i].Add(1)
+	r.sum.Add(int64(d))
+}
+
+// snapshot returns the current histogram or nil if r is nil.
+func (r *latencyRecorder) snapshot() *LatencyHistogram {
+	if r == nil {
+		return nil
+	}
+	h := &LatencyHistogram{Bounds: latencyBounds, Counts: make([]uint64, len(r.counts)), Sum: time.Duration(r.sum.Load())}
+	for i := range r.counts {
+		h.Counts[i] = r.counts[i].Load()
+	}
+	return h
+}
+
+// NamedBusStats are the Stats of a named singleton, see NamedStats.
+type NamedBusStats struct {
+	NamedBusInfo
+	Stats Stats
+}
+
+// NamedStats returns the Stats of all named singletons ordered like
+// NamedBuses.
+func NamedStats() []NamedBusStats {
+	infos := NamedBuses()
+	inspectors := make([]Inspector, len(infos))
+	registryMtx.Lock()
+	for i, info := range infos {
+		inspectors[i], _ = registry[registryKey{name: info.Name, worker: info.Worker}].bus.(Inspector)
+	}
+	registryMtx.Unlock()
+
+	stats := make([]NamedBusStats, 0, len(infos))
+	for i, info := range infos {
+		if inspectors[i] != nil { // nil if removed in the meantime
+			stats = append(stats, NamedBusStats{NamedBusInfo: info, Stats: inspectors[i].Stats()})
+		}
+	}
+	return stats
+}
+
+// StatsVar returns an expvar.Var that reports NamedStats as JSON, e.g.
+//
+//	expvar.Publish("buses", bus.StatsVar())
+func StatsVar() expvar.Var {
+	return expvar.Func(func() any {
+		type namedStats struct {
+			Name   string
+			Type   string
+			Worker bool
+			Stats  Stats
+		}
+		stats := NamedStats()
+		out := make([]namedStats, len(stats))
+		for i, s := range stats {
+			out[i] = namedStats{Name: s.Name, Type: s.Type.String(), Worker: s.Worker, Stats: s.Stats}
+		}
+		return out
+	})
+}
@@ -0,0 +1,135 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestBusStats(t *testing.T) {
+	b := NewBus[int](WithLatencyStats[int]())
+	unsubscribe := b.Subscribe(func(int) {})
+	b.Subscribe(func(int) { time.Sleep(2 * time.Millisecond) })
+	b.Subscribe(func(int) { panic("boom") })
+	b.Publish(1)
+	b.Publish(2)
+	unsubscribe()
+
+	stats := b.(Inspector).Stats()
+	if stats.Subscribers != 2 || stats.Published != 2 || stats.Delivered != 6 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	slow, panicking := stats.Subscriptions[0], stats.Subscriptions[1]
+	if slow.Delivered != 2 || panicking.Panics != 2 {
+		t.Fatalf("unexpected subscriber stats %+v", stats.Subscriptions)
+	}
+	if slow.Latency.Count() != 2 || slow.Latency.Mean() < 2*time.Millisecond || slow.Latency.Quantile(0.5) != 10*time.Millisecond {
+		t.Fatalf("unexpected latency %+v", slow.Latency)
+	}
+	if NewBus[int]().(Inspector).Stats().Subscriptions == nil {
+		t.Fatal("expected an empty list of subscriptions")
+	}
+}
+
+func TestBusStatsCountOnlyDeliveredMessages(t *testing.T) {
+	b := NewBus(WithDeliveryInterceptors(func(id int64, msg int, next func(int)) {
+		if msg != 2 {
+			next(msg)
+		}
+	}))
+	b.Subscribe(func(int) {})
+	s := SubscribeContext(context.Background(), b, func(int) {})
+	b.Publish(1)
+	b.Publish(2) // dropped by the interceptor
+	s.Pause()
+	b.Publish(3) // skipped by s
+	s.Resume()
+
+	stats := b.(Inspector).Stats()
+	if stats.Published != 3 || stats.Delivered != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if always, paused := stats.Subscriptions[0], stats.Subscriptions[1]; always.Delivered != 2 || paused.Delivered != 1 {
+		t.Fatalf("unexpected subscriber stats %+v", stats.Subscriptions)
+	}
+}
+
+func TestReplayBusStatsCountReplayedMessagesOnce(t *testing.T) {
+	b := NewReplayBus[int](10, 0)
+	b.Publish(0)
+	b.Subscribe(func(msg int) {
+		if msg == 0 {
+			b.Publish(1) // held back until the replay finished
+		}
+	})
+	b.Subscribe(func(int) {})
+
+	stats := b.(Inspector).Stats()
+	if stats.Published != 2 || stats.Delivered != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if first, second := stats.Subscriptions[0], stats.Subscriptions[1]; first.Delivered != 2 || second.Delivered != 2 {
+		t.Fatalf("unexpected subscriber stats %+v", stats.Subscriptions)
+	}
+}
+
+func TestWorkerBusStats(t *testing.T) {
+	b := NewWorkerBus[int](2)
+	release := make(chan struct{})
+	_, _ = blockedSubscriber(t, b, release, WithOverflowPolicy[int](DropNewest))
+	b.SubscribeGroup("group", func(int) {})
+	b.SubscribeGroup("group", func(int) {})
+	for i := 0; i < 5; i++ {
+		b.Publish(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	stats := b.Stats()
+	if stats.Subscribers != 3 || stats.Published != 6 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	blocked := stats.Subscriptions[0]
+	if blocked.Delivered != 1 || blocked.Queued != 2 || blocked.Dropped != 3 {
+		t.Fatalf("unexpected stats of the blocked subscriber %+v", blocked)
+	}
+	if stats.Subscriptions[1].Delivered+stats.Subscriptions[2].Delivered != 5 {
+		t.Fatalf("expected group members to share the messages, got %+v", stats.Subscriptions)
+	}
+
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stats = b.Stats()
+	if stats.Subscribers != 0 || stats.Delivered != 8 || stats.Dropped != 3 || stats.Queued != 0 {
+		t.Fatalf("expected counters of stopped subscribers to be kept, got %+v", stats)
+	}
+}
+
+func TestNamedStats(t *testing.T) {
+	ResetNamedBuses()
+	defer ResetNamedBuses()
+	MustGetNamedTypedBus[string]("stats").Publish("a")
+	MustGetNamedTypedWorkerBus[int]("stats")
+
+	stats := NamedStats()
+	if len(stats) != 2 || stats[0].Worker || stats[0].Stats.Published != 1 || !stats[1].Worker {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	var exported []struct {
+		Name   string
+		Type   string
+		Worker bool
+		Stats  Stats
+	}
+	if err := json.Unmarshal([]byte(StatsVar().String()), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 2 || exported[0].Name != "stats" || exported[0].Type != "string" || exported[0].Stats.Published != 1 {
+		t.Fatalf("unexpected export %+v", exported)
+	}
+}
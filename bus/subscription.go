@@ -0,0 +1,288 @@
+package bus
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Subscription is the handle of a Subscriber, see SubscribeContext and
+// WorkerBus.SubscribeWithOptions.
+type Subscription interface {
+	// Unsubscribe unsubscribes the Subscriber. Messages that are already
+	// queued for the Subscriber are still delivered. Calling Unsubscribe
+	// again or after the bus was closed has no effect.
+	Unsubscribe()
+
+	// Pause stops delivering messages to the Subscriber until Resume is
+	// called. A WorkerBus keeps queueing messages for a paused Subscriber,
+	// subject to its OverflowPolicy, other buses skip them.
+	Pause()
+
+	// Resume continues delivering messages after Pause.
+	Resume()
+
+	// Done returns a channel that is closed once no more messages are
+	// delivered to the Subscriber, because it was unsubscribed or the bus
+	// was closed.
+	Done() <-chan struct{}
+
+	// Dropped returns the number of messages that were discarded because the
+	// queue of the Subscriber was full, see OverflowPolicy.
+	Dropped() uint64
+
+	// Stats returns the counters of the Subscription.
+	Stats() SubscriptionStats
+}
+
+// SubscriptionStats are the counters of a Subscription.
+type SubscriptionStats struct {
+	Delivered uint64 // messages handed to the Subscriber
+	Skipped   uint64 // messages skipped while the Subscription was paused
+	Dropped   uint64 // messages discarded by the OverflowPolicy
+}
+
+// SubscribeContext subscribes sub to b and returns its Subscription. The
+// Subscription is unsubscribed once ctx ends. The options only apply if b is
+// a WorkerBus.
+func SubscribeContext[E any](ctx context.Context, b Bus[E], sub Subscriber[E], opts ...SubscribeOption[E]) Subscription {
+	var s Subscription
+	if wb, ok := b.(WorkerBus[E]); ok {
+		s = wb.SubscribeWithOptions(sub, opts...)
+	} else {
+		s = newSubscription(b, sub)
+	}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.Unsubscribe()
+			case <-s.Done():
+			}
+		}()
+	}
+	return s
+}
+
+// SubscribeOnce subscribes sub to b for a single message. The Subscription
+// is unsubscribed before sub is called. The options only apply if b is a
+// WorkerBus.
+func SubscribeOnce[E any](b Bus[E], sub Subscriber[E], opts ...SubscribeOption[E]) Subscription {
+	once := &sync.Once{}
+	if wb, ok := b.(WorkerBus[E]); ok {
+		ready := make(chan struct{})
+		var s Subscription
+		s = wb.SubscribeWithOptions(func(msg E) {
+			once.Do(func() {
+				<-ready // messages are delivered by the workers, wait until s is set
+				s.Unsubscribe()
+				sub(msg)
+			})
+		}, opts...)
+		close(ready)
+		return s
+	}
+	s := &subscription[E]{done: make(chan struct{}), mtx: &sync.Mutex{}}
+	s.sub = func(msg E) {
+		once.Do(func() {
+			s.Unsubscribe()
+			sub(msg)
+		})
+	}
+	s.subscribe(b)
+	return s
+}
+
+// subscription is the Subscription of a Subscriber of a Bus that only
+// provides an unsubscribe function. A paused subscription skips messages,
+// as the Bus might deliver them on the publishing go-routine.
+type subscription[E any] struct {
+	sub       Subscriber[E]
+	ctxSub    ContextSubscriber[E] // used instead of sub by buses that propagate contexts
+	done      chan struct{}
+	paused    atomic.Bool
+	delivered atomic.Uint64
+	skipped   atomic.Uint64
+
+	mtx         *sync.Mutex
+	unsubscribe func() // nil until Subscribe of the Bus returned
+	ended       bool
+}
+
+func newSubscription[E any](b Bus[E], sub Subscriber[E]) *subscription[E] {
+	s := &subscription[E]{sub: sub, done: make(chan struct{}), mtx: &sync.Mutex{}}
+	s.subscribe(b)
+	return s
+}
+
+func newContextSubscription[E any](b Bus[E], sub ContextSubscriber[E]) *subscription[E] {
+	s := &subscription[E]{
+		sub:    func(msg E) { sub(context.Background(), msg) },
+		ctxSub: sub,
+		done:   make(chan struct{}),
+		mtx:    &sync.Mutex{},
+	}
+	s.subscribe(b)
+	return s
+}
+
+// subscribe subscribes s to b. The Subscriber may already be called, and
+// unsubscribe s, before Subscribe of b returns, e.g. by a ReplayBus.
+func (s *subscription[E]) subscribe(b Bus[E]) {
+	var unsubscribe func()
+	if gb, ok := b.(gatedSubscribable[E]); ok {
+		unsubscribe = gb.subscribeGated(s.sub, s.ctxSub, s.admit) // skipped messages are not delivered
+	} else {
+		unsubscribe = b.Subscribe(s.deliver)
+	}
+	s.mtx.Lock()
+	s.unsubscribe = unsubscribe
+	ended := s.ended
+	s.mtx.Unlock()
+	if ended {
+		unsubscribe()
+	}
+}
+
+func (s *subscription[E]) deliver(msg E) {
+	if s.admit() {
+		s.sub(msg)
+	}
+}
+
+// admit reports whether a message is handed to the Subscriber and counts it.
+func (s *subscription[E]) admit() bool {
+	select {
+	case <-s.done:
+		return false // unsubscribed while msg was published
+	default:
+	}
+	if s.paused.Load() {
+		s.skipped.Add(1)
+		return false
+	}
+	s.delivered.Add(1)
+	return true
+}
+
+func (s *subscription[E]) Unsubscribe() {
+	s.mtx.Lock()
+	if s.ended {
+		s.mtx.Unlock()
+		return
+	}
+	s.ended = true
+	close(s.done)
+	unsubscribe := s.unsubscribe
+	s.mtx.Unlock()
+	if unsubscribe != nil {
+		unsubscribe()
+	}
+}
+
+func (s *subscription[E]) Pause() {
+	s.paused.Store(true)
+}
+
+func (s *subscription[E]) Resume() {
+	s.paused.Store(false)
+}
+
+func (s *subscription[E]) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *subscription[E]) Dropped() uint64 {
+	return 0
+}
+
+func (s *subscription[E]) Stats() SubscriptionStats {
+	return SubscriptionStats{Delivered: s.delivered.Load(), Skipped: s.skipped.Load()}
+}
+
+// A SubscribeOption configures a single Subscriber of a WorkerBus.
+type SubscribeOption[E any] func(o *subscribeOptions[E])
+
+type subscribeOptions[E any] struct {
+	policy  OverflowPolicy
+	timeout time.Duration
+	workers int
+	key     func(msg E) uint64
+
+	// used by SubscribeGroup only
+	strategy GroupStrategy
+
+	// used by SubscribeWithRetry only
+	retry       RetryPolicy
+	deadLetters Bus[DeadLetter[E]]
+}
+
+func newSubscribeOptions[E any](opts []SubscribeOption[E]) subscribeOptions[E] {
+	o := subscribeOptions[E]{
+		policy:  Block,
+		workers: 1,
+		retry:   DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithOverflowPolicy sets the OverflowPolicy of the Subscriber. The default
+// is Block.
+func WithOverflowPolicy[E any](policy OverflowPolicy) SubscribeOption[E] {
+	return func(o *subscribeOptions[E]) {
+		o.policy = policy
+	}
+}
+
+// WithOverflowTimeout sets the OverflowPolicy of the Subscriber to
+// BlockWithTimeout with the given timeout.
+func WithOverflowTimeout[E any](timeout time.Duration) SubscribeOption[E] {
+	return func(o *subscribeOptions[E]) {
+		o.policy = BlockWithTimeout
+		o.timeout = timeout
+	}
+}
+
+// WithWorkers lets n go-routines call the Subscriber concurrently. Each worker
+// has its own queue of the WorkerBus' queue length. Without WithPartitionKey,
+// messages are distributed round-robin and may be handled out of order.
+func WithWorkers[E any](n int) SubscribeOption[E] {
+	return func(o *subscribeOptions[E]) {
+		o.workers = max(n, 1)
+	}
+}
+
+// WithPartitionKey partitions messages between the workers of the Subscriber
+// (see WithWorkers) by the key returned for each message. Messages with the
+// same key are always handled by the same worker in the order they were
+// published, while messages with different keys are handled in parallel.
+func WithPartitionKey[E any, K comparable](key func(msg E) K) SubscribeOption[E] {
+	seed := maphash.MakeSeed()
+	return func(o *subscribeOptions[E]) {
+		o.key = func(msg E) uint64 {
+			return maphash.Comparable(seed, key(msg))
+		}
+	}
+}
+
+// WithRetryPolicy sets the RetryPolicy of a Subscriber subscribed with
+// SubscribeWithRetry. The default is DefaultRetryPolicy.
+func WithRetryPolicy[E any](policy RetryPolicy) SubscribeOption[E] {
+	return func(o *subscribeOptions[E]) {
+		o.retry = policy
+	}
+}
+
+// WithDeadLetters sets the Bus that receives messages a Subscriber subscribed
+// with SubscribeWithRetry failed to handle. Without a dead-letter Bus, such
+// messages are logged and discarded.
+func WithDeadLetters[E any](deadLetters Bus[DeadLetter[E]]) SubscribeOption[E] {
+	return func(o *subscribeOptions[E]) {
+		o.deadLetters = deadLetters
+	}
+}
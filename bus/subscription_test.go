@@ -0,0 +1,138 @@
+package bus
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/**
+ * Tests
+ */
+func TestSubscribeContextUnsubscribesWhenContextEnds(t *testing.T) {
+	for name, b := range map[string]Bus[int]{"Bus": NewBus[int](), "WorkerBus": NewWorkerBus[int](10)} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			received := make(chan int, 10)
+			s := SubscribeContext(ctx, b, func(msg int) { received <- msg })
+			b.Publish(1)
+			expectMsg(t, received, 1)
+			cancel()
+			select {
+			case <-s.Done():
+			case <-time.After(time.Second):
+				t.Fatal("expected Done to be closed once the context ended")
+			}
+			b.Publish(2)
+			time.Sleep(10 * time.Millisecond)
+			if len(received) != 0 {
+				t.Fatalf("expected no messages after the context ended, got %d", <-received)
+			}
+			if stats := s.Stats(); stats.Delivered != 1 {
+				t.Fatalf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestSubscriptionPauseSkipsOnBus(t *testing.T) {
+	b := NewBus[int]()
+	var msgs []int
+	s := SubscribeContext(context.Background(), b, func(msg int) { msgs = append(msgs, msg) })
+	b.Publish(1)
+	s.Pause()
+	b.Publish(2)
+	s.Resume()
+	b.Publish(3)
+	if len(msgs) != 2 || msgs[0] != 1 || msgs[1] != 3 {
+		t.Fatalf("expected the message published while paused to be skipped, got %v", msgs)
+	}
+	if stats := s.Stats(); stats.Delivered != 2 || stats.Skipped != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSubscriptionPauseQueuesOnWorkerBus(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	received := make(chan int, 10)
+	s := b.SubscribeWithOptions(func(msg int) { received <- msg })
+	s.Pause()
+	for i := 0; i < 3; i++ {
+		b.Publish(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(received) != 0 {
+		t.Fatalf("expected no deliveries while paused, got %d", len(received))
+	}
+	s.Resume()
+	for i := 0; i < 3; i++ {
+		expectMsg(t, received, i)
+	}
+
+	s.Pause()
+	b.Publish(3)
+	if err := b.Close(); err != nil { // must not wait for Resume
+		t.Fatal(err)
+	}
+	expectMsg(t, received, 3)
+	if stats := s.Stats(); stats.Delivered != 4 || stats.Skipped != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSubscriptionUnsubscribeIsIdempotent(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	s := b.SubscribeWithOptions(func(int) {})
+	other := b.SubscribeWithOptions(func(int) {})
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []Subscription{s, other} {
+		select {
+		case <-s.Done():
+		default:
+			t.Fatal("expected Done to be closed once the bus was closed")
+		}
+	}
+	s.Unsubscribe()
+	s.Unsubscribe() // must not panic
+
+	late := b.SubscribeWithOptions(func(int) {})
+	late.Unsubscribe()
+	<-late.Done()
+
+	h := SubscribeContext(context.Background(), NewBus[int](), func(int) {})
+	h.Unsubscribe()
+	h.Unsubscribe()
+	<-h.Done()
+}
+
+func TestSubscribeOnce(t *testing.T) {
+	for name, b := range map[string]Bus[int]{
+		"Bus":       NewBus[int](),
+		"WorkerBus": NewWorkerBus[int](10),
+		"ReplayBus": NewReplayBus[int](10, 0), // delivers during Subscribe
+	} {
+		t.Run(name, func(t *testing.T) {
+			b.Publish(1)
+			var calls atomic.Int32
+			received := make(chan int, 10)
+			s := SubscribeOnce(b, func(msg int) {
+				calls.Add(1)
+				received <- msg
+			}, WithWorkers[int](4))
+			b.Publish(2)
+			b.Publish(3)
+			select {
+			case <-s.Done():
+			case <-time.After(time.Second):
+				t.Fatal("expected Done to be closed after the first message")
+			}
+			time.Sleep(10 * time.Millisecond)
+			if calls.Load() != 1 || len(received) != 1 {
+				t.Fatalf("expected a single call, got %d", calls.Load())
+			}
+		})
+	}
+}
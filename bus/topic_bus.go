@@ -0,0 +1,235 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidPattern is returned by TopicBus.Subscribe if the given pattern is malformed.
+var ErrInvalidPattern = errors.New("invalid topic pattern")
+
+const (
+	topicSeparator    = "."
+	topicWildcard     = "*" // matches exactly one segment
+	topicFullWildcard = ">" // matches one or more trailing segments
+)
+
+// A TopicSubscriber is called with messages that are published on a TopicBus
+// together with the topic the message was published on.
+type TopicSubscriber[E any] func(topic string, msg E)
+
+// A TopicBus routes messages by hierarchical topics. A topic consists of
+// dot-separated segments, e.g. "orders.eu.created". Subscriptions are made
+// with patterns that may contain wildcards: "*" matches exactly one segment
+// and ">" matches one or more remaining segments ("orders.>" matches
+// "orders.eu" and "orders.eu.created", but not "orders").
+type TopicBus[E any] interface {
+	// Publish a Message on the given topic. The Message is forwarded to all
+	// Subscriber(s) whose pattern matches the topic. Topics that contain
+	// wildcards or empty segments never match any pattern.
+	Publish(topic string, msg E)
+
+	// Subscribe to all topics that match the given pattern. The returned
+	// function unsubscribes the given Subscriber. An error is returned if
+	// the pattern is malformed.
+	Subscribe(pattern string, sub TopicSubscriber[E]) (unsubscribe func(), err error)
+}
+
+type topicBusImpl[E any] struct {
+	mtx  *sync.RWMutex
+	root *topicNode[E]
+}
+
+// NewTopicBus creates a TopicBus. Subscriptions are kept in a trie keyed by
+// topic segments, so the cost of Publish depends on the depth of the topic
+// and the number of matching subscriptions, not on the total number of
+// subscriptions. Like Bus, callers of Publish directly invoke all matching
+// Subscribers.
+func NewTopicBus[E any]() TopicBus[E] {
+	return &topicBusImpl[E]{
+		mtx:  &sync.RWMutex{},
+		root: newTopicNode[E](),
+	}
+}
+
+func (b *topicBusImpl[E]) Publish(topic string, msg E) {
+	if !validTopic(topic) {
+		return
+	}
+	b.mtx.RLock()
+	var matches []*topicSub[E]
+	matches = b.root.match(topic, matches)
+	b.mtx.RUnlock()
+	for _, sub := range matches {
+		sub.sub(topic, msg)
+	}
+}
+
+func (b *topicBusImpl[E]) Subscribe(pattern string, sub TopicSubscriber[E]) (unsubscribe func(), err error) {
+	segs, err := splitPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	s := &topicSub[E]{sub: sub}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.root.insert(segs, s)
+	once := &sync.Once{}
+	return func() {
+		once.Do(func() {
+			b.mtx.Lock()
+			defer b.mtx.Unlock()
+			b.root.remove(segs, s)
+		})
+	}, nil
+}
+
+// A TopicPattern is a parsed subscription pattern that can be matched
+// against topics without a TopicBus, e.g. to select messages by topic
+// elsewhere.
+type TopicPattern struct {
+	segs []string
+}
+
+// ParseTopicPattern parses a pattern as used by TopicBus.Subscribe. An error
+// is returned if the pattern is malformed.
+func ParseTopicPattern(pattern string) (TopicPattern, error) {
+	segs, err := splitPattern(pattern)
+	return TopicPattern{segs: segs}, err
+}
+
+// Match reports whether the topic matches the pattern, following the same
+// rules as a TopicBus.
+func (p TopicPattern) Match(topic string) bool {
+	if !validTopic(topic) {
+		return false
+	}
+	segs := strings.Split(topic, topicSeparator)
+	for i, seg := range p.segs {
+		if seg == topicFullWildcard {
+			return len(segs) > i
+		}
+		if i >= len(segs) || (seg != topicWildcard && seg != segs[i]) {
+			return false
+		}
+	}
+	return len(segs) == len(p.segs)
+}
+
+type topicSub[E any] struct {
+	sub TopicSubscriber[E]
+}
+
+type topicNode[E any] struct {
+	children map[string]*topicNode[E] // literal segments
+	wildcard *topicNode[E]            // "*"
+	subs     []*topicSub[E]           // patterns ending at this node
+	fwcSubs  []*topicSub[E]           // patterns ending with ">" after this node
+}
+
+func newTopicNode[E any]() *topicNode[E] {
+	return &topicNode[E]{children: map[string]*topicNode[E]{}}
+}
+
+func (n *topicNode[E]) insert(segs []string, s *topicSub[E]) {
+	if len(segs) == 0 {
+		n.subs = append(n.subs, s)
+		return
+	}
+	switch seg := segs[0]; seg {
+	case topicFullWildcard:
+		n.fwcSubs = append(n.fwcSubs, s)
+	case topicWildcard:
+		if n.wildcard == nil {
+			n.wildcard = newTopicNode[E]()
+		}
+		n.wildcard.insert(segs[1:], s)
+	default:
+		child, ok := n.children[seg]
+		if !ok {
+			child = newTopicNode[E]()
+			n.children[seg] = child
+		}
+		child.insert(segs[1:], s)
+	}
+}
+
+// remove deletes s from the trie and prunes nodes that became empty. Returns
+// true if n itself is empty afterward.
+func (n *topicNode[E]) remove(segs []string, s *topicSub[E]) (empty bool) {
+	if len(segs) == 0 {
+		n.subs = removeTopicSub(n.subs, s)
+		return n.empty()
+	}
+	switch seg := segs[0]; seg {
+	case topicFullWildcard:
+		n.fwcSubs = removeTopicSub(n.fwcSubs, s)
+	case topicWildcard:
+		if n.wildcard != nil && n.wildcard.remove(segs[1:], s) {
+			n.wildcard = nil
+		}
+	default:
+		if child, ok := n.children[seg]; ok && child.remove(segs[1:], s) {
+			delete(n.children, seg)
+		}
+	}
+	return n.empty()
+}
+
+func (n *topicNode[E]) empty() bool {
+	return len(n.children) == 0 && n.wildcard == nil && len(n.subs) == 0 && len(n.fwcSubs) == 0
+}
+
+// match appends all subscriptions matching the (remaining) topic to matches.
+func (n *topicNode[E]) match(topic string, matches []*topicSub[E]) []*topicSub[E] {
+	if topic == "" {
+		return append(matches, n.subs...)
+	}
+	matches = append(matches, n.fwcSubs...)
+	seg, rest, _ := strings.Cut(topic, topicSeparator)
+	if child, ok := n.children[seg]; ok {
+		matches = child.match(rest, matches)
+	}
+	if n.wildcard != nil {
+		matches = n.wildcard.match(rest, matches)
+	}
+	return matches
+}
+
+func removeTopicSub[E any](subs []*topicSub[E], s *topicSub[E]) []*topicSub[E] {
+	for i, sub := range subs {
+		if sub == s {
+			return append(subs[:i:i], subs[i+1:]...)
+		}
+	}
+	return subs
+}
+
+func validTopic(topic string) bool {
+	for rest, more := topic, true; more; {
+		var seg string
+		seg, rest, more = strings.Cut(rest, topicSeparator)
+		if seg == "" || seg == topicWildcard || seg == topicFullWildcard {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPattern(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("%w: empty pattern", ErrInvalidPattern)
+	}
+	segs := strings.Split(pattern, topicSeparator)
+	for i, seg := range segs {
+		if seg == "" {
+			return nil, fmt.Errorf("%w: %q contains an empty segment", ErrInvalidPattern, pattern)
+		}
+		if seg == topicFullWildcard && i != len(segs)-1 {
+			return nil, fmt.Errorf("%w: %q has %q before the last segment", ErrInvalidPattern, pattern, topicFullWildcard)
+		}
+	}
+	return segs, nil
+}
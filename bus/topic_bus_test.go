@@ -0,0 +1,154 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+/**
+ * Tests
+ */
+func TestTopicBusPatternMatching(t *testing.T) {
+	cases := []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"orders.eu.created", "orders.eu.created", true},
+		{"orders.eu.created", "orders.us.created", false},
+		{"orders.*.created", "orders.eu.created", true},
+		{"orders.*.created", "orders.eu.deleted", false},
+		{"orders.*", "orders.eu.created", false},
+		{"orders.>", "orders.eu", true},
+		{"orders.>", "orders.eu.created", true},
+		{"orders.>", "orders", false},
+		{"*.eu.>", "orders.eu.created", true},
+		{">", "orders", true},
+		{"orders", "orders.eu", false},
+	}
+	for _, c := range cases {
+		b := NewTopicBus[int]()
+		received := false
+		if _, err := b.Subscribe(c.pattern, func(string, int) { received = true }); err != nil {
+			t.Fatal(err)
+		}
+		b.Publish(c.topic, 1)
+		if received != c.match {
+			t.Errorf("pattern %q, topic %q: expected match=%v", c.pattern, c.topic, c.match)
+		}
+		p, err := ParseTopicPattern(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Match(c.topic) != c.match {
+			t.Errorf("TopicPattern %q, topic %q: expected match=%v", c.pattern, c.topic, c.match)
+		}
+	}
+}
+
+func TestTopicBusSubscriberReceivesTopic(t *testing.T) {
+	b := NewTopicBus[int]()
+	var topics []string
+	if _, err := b.Subscribe("a.*", func(topic string, _ int) { topics = append(topics, topic) }); err != nil {
+		t.Fatal(err)
+	}
+	b.Publish("a.x", 1)
+	b.Publish("a.y", 2)
+	b.Publish("b.x", 3)
+	sort.Strings(topics)
+	if fmt.Sprint(topics) != "[a.x a.y]" {
+		t.Fatalf("unexpected topics: %v", topics)
+	}
+}
+
+func TestTopicBusOverlappingPatternsAllReceive(t *testing.T) {
+	b := NewTopicBus[int]()
+	count := 0
+	for _, p := range []string{"a.b", "a.*", "a.>", "*.b", ">"} {
+		if _, err := b.Subscribe(p, func(string, int) { count++ }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Publish("a.b", 1)
+	if count != 5 {
+		t.Fatalf("expected 5 deliveries, got %d", count)
+	}
+}
+
+func TestTopicBusUnsubscribe(t *testing.T) {
+	b := NewTopicBus[int]()
+	count := 0
+	unsubscribe, err := b.Subscribe("a.*.c", func(string, int) { count++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Publish("a.b.c", 1)
+	unsubscribe()
+	unsubscribe() // must be idempotent
+	b.Publish("a.b.c", 1)
+	if count != 1 {
+		t.Fatalf("expected 1 delivery, got %d", count)
+	}
+	if !b.(*topicBusImpl[int]).root.empty() {
+		t.Fatal("expected trie to be pruned after unsubscribe")
+	}
+}
+
+func TestTopicBusUnsubscribeFromSubscriber(t *testing.T) {
+	b := NewTopicBus[int]()
+	count := 0
+	var unsubscribe func()
+	unsubscribe, err := b.Subscribe("a", func(string, int) {
+		count++
+		unsubscribe()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Publish("a", 1)
+	b.Publish("a", 2)
+	if count != 1 {
+		t.Fatalf("expected 1 delivery, got %d", count)
+	}
+}
+
+func TestTopicBusInvalidPatterns(t *testing.T) {
+	b := NewTopicBus[int]()
+	for _, p := range []string{"", "a..b", ".a", "a.", "a.>.b", ">.a"} {
+		if _, err := b.Subscribe(p, func(string, int) {}); !errors.Is(err, ErrInvalidPattern) {
+			t.Errorf("pattern %q: expected ErrInvalidPattern, got %v", p, err)
+		}
+	}
+}
+
+func TestTopicBusInvalidTopicsAreNotDelivered(t *testing.T) {
+	b := NewTopicBus[int]()
+	count := 0
+	if _, err := b.Subscribe(">", func(string, int) { count++ }); err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"", "a..b", "a.*", "a.>", "a."} {
+		b.Publish(topic, 1)
+	}
+	if count != 0 {
+		t.Fatalf("expected no deliveries for invalid topics, got %d", count)
+	}
+}
+
+/**
+ * Benchmarks
+ */
+func BenchmarkTopicBusPublish__1_Match_10000_Subs(b *testing.B) {
+	bu := NewTopicBus[int]()
+	for i := 0; i < 10000; i++ {
+		s := &busBenchSub[int]{0}
+		_, _ = bu.Subscribe(fmt.Sprintf("orders.%d.*", i), func(_ string, msg int) { s.HandleMessage(msg) })
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bu.Publish("orders.42.created", i)
+	}
+}
@@ -0,0 +1,147 @@
+package bus
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// defaultWheel drives the timers of all rate-limiting Subscribers, see Batch,
+// Debounce, Throttle and Sample.
+var defaultWheel = newTimerWheel(10*time.Millisecond, 512)
+
+// timerWheel is a hashed timer wheel. Timers are kept in slots that are
+// visited once per tick, so scheduling and stopping cost O(1) regardless of
+// the number of timers, and a single go-routine serves all of them. The
+// go-routine only runs while timers are scheduled. Timers fire at a
+// resolution of one tick.
+type timerWheel struct {
+	mtx     *sync.Mutex
+	tick    time.Duration
+	slots   []map[*wheelTimer]struct{}
+	pos     int
+	count   int
+	running bool
+}
+
+func newTimerWheel(tick time.Duration, slots int) *timerWheel {
+	w := &timerWheel{
+		mtx:   &sync.Mutex{},
+		tick:  tick,
+		slots: make([]map[*wheelTimer]struct{}, slots),
+	}
+	for i := range w.slots {
+		w.slots[i] = map[*wheelTimer]struct{}{}
+	}
+	return w
+}
+
+// wheelTimer calls fn in a new go-routine once it fires. fn is called with
+// mtx held and only if the timer was neither stopped nor reset since it
+// became due, so stopping or resetting the timer with mtx held reliably
+// cancels it. Panics of fn are recovered and logged.
+type wheelTimer struct {
+	w         *timerWheel
+	mtx       sync.Locker
+	fn        func()
+	slot      int
+	rounds    int    // full rotations of the wheel until the timer fires
+	gen       uint64 // incremented by reset and stop, see fire
+	scheduled bool
+}
+
+func (w *timerWheel) newTimer(mtx sync.Locker, fn func()) *wheelTimer {
+	return &wheelTimer{w: w, mtx: mtx, fn: fn}
+}
+
+// reset (re)schedules the timer to fire after d, rounded up to full ticks.
+func (t *wheelTimer) reset(d time.Duration) {
+	w := t.w
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.remove(t)
+	t.gen++
+	ticks := max(int((d+w.tick-1)/w.tick), 1)
+	t.slot = (w.pos + ticks) % len(w.slots)
+	t.rounds = (ticks - 1) / len(w.slots)
+	t.scheduled = true
+	w.slots[t.slot][t] = struct{}{}
+	w.count++
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+// stop unschedules the timer. Returns false if it was not scheduled.
+func (t *wheelTimer) stop() bool {
+	t.w.mtx.Lock()
+	defer t.w.mtx.Unlock()
+	t.gen++
+	return t.w.remove(t)
+}
+
+func (w *timerWheel) remove(t *wheelTimer) bool {
+	if !t.scheduled {
+		return false
+	}
+	delete(w.slots[t.slot], t)
+	t.scheduled = false
+	w.count--
+	return true
+}
+
+// run advances the wheel every tick and fires due timers until no timer is
+// scheduled anymore.
+func (w *timerWheel) run() {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+	for range ticker.C {
+		w.mtx.Lock()
+		w.pos = (w.pos + 1) % len(w.slots)
+		var due []*wheelTimer
+		var gens []uint64
+		for t := range w.slots[w.pos] {
+			if t.rounds > 0 {
+				t.rounds--
+				continue
+			}
+			due = append(due, t)
+			gens = append(gens, t.gen)
+		}
+		for _, t := range due {
+			w.remove(t)
+		}
+		idle := w.count == 0
+		if idle {
+			w.running = false
+		}
+		w.mtx.Unlock()
+		for i, t := range due {
+			go t.fire(gens[i])
+		}
+		if idle {
+			return
+		}
+	}
+}
+
+// fire calls fn unless the timer was stopped or reset since it became due
+// with generation gen.
+func (t *wheelTimer) fire(gen uint64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.w.mtx.Lock()
+	cancelled := t.gen != gen
+	t.w.mtx.Unlock()
+	if cancelled {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("bus: subscriber panicked in timer: %v\n%s", r, debug.Stack())
+		}
+	}()
+	t.fn()
+}
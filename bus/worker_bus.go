@@ -1,8 +1,13 @@
 package bus
 
 import (
+	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/jjxxs/gopher-tools/signal"
 )
 
 // A WorkerBus uses a queue to buffer message that are passed via Bus.Publish.
@@ -16,27 +21,81 @@ type WorkerBus[E any] interface {
 	// a maximum amount of time before cancelling the operation. Returns true of the
 	// message was enqueued, false if not.
 	PublishTimeout(msg E, timeout time.Duration) bool
+
+	// PublishContext publishes a message on the Bus, waiting for queue space
+	// until ctx ends. Returns ctx.Err() if ctx ended before, an error wrapping
+	// ErrQueueFull and ctx.Err() if ctx ended while waiting and ErrClosed if
+	// the Bus is closed. ctx is passed on to ContextSubscribers without its
+	// deadline and cancellation, as the message outlives the call.
+	PublishContext(ctx context.Context, msg E) error
+
+	// PublishWithPriority publishes a message in the lane of the given
+	// Priority. Messages of higher priority overtake queued messages of lower
+	// priority in the queue of the Bus and in the queues of the Subscribers,
+	// according to the PriorityPolicy set by WithPriorityPolicy. Publish uses
+	// PriorityNormal.
+	PublishWithPriority(msg E, prio Priority)
+
+	// PublishAfter publishes a message on the Bus once d elapsed. Messages that
+	// are not due yet when the Bus is closed are never published, unless they
+	// are persisted, see WithScheduleFile.
+	PublishAfter(msg E, d time.Duration) Scheduled
+
+	// PublishAt publishes a message on the Bus at t, see PublishAfter.
+	PublishAt(msg E, t time.Time) Scheduled
+
+	// Close stops accepting messages and blocks until all messages that were
+	// already queued have been delivered to the Subscriber(s). Messages published
+	// after Close are dropped. Close must not be called from a Subscriber.
+	Close() error
+
+	// Drain works like Close, but returns the context's error if the context
+	// ends before all queued messages were delivered. Delivery of the remaining
+	// messages continues in the background.
+	Drain(ctx context.Context) error
+
+	// Flush blocks until all messages that were published before the call have
+	// been delivered to, or dropped by, every current Subscriber, without
+	// stopping the bus. It waits for paused Subscribers to resume. Returns the
+	// context's error if the context ends first. Flush must not be called from
+	// a Subscriber.
+	Flush(ctx context.Context) error
+
+	// SubscribeWithOptions works like Subscribe, but allows configuring the
+	// Subscriber, e.g. its OverflowPolicy.
+	SubscribeWithOptions(sub Subscriber[E], opts ...SubscribeOption[E]) Subscription
+
+	// SubscribeWithRetry subscribes a Subscriber that can fail. Failed messages
+	// are retried according to the RetryPolicy set by WithRetryPolicy and are
+	// published on the Bus set by WithDeadLetters once all attempts failed.
+	// The Subscriber's worker waits while a message is retried, so messages
+	// are still handled in order. Close, Drain and Unsubscribe cut the wait
+	// short, the message is then given up on without further attempts.
+	SubscribeWithRetry(sub ErrorSubscriber[E], opts ...SubscribeOption[E]) Subscription
+
+	// Stats returns the counters of the bus and its Subscribers, see Inspector.
+	// Every member of a group is reported as a Subscriber.
+	Stats() Stats
+
+	// SubscribeGroup subscribes a Subscriber as a member of the named group.
+	// Every message is delivered to exactly one member of the group, chosen
+	// by the GroupStrategy set by WithGroupStrategy. Messages that are queued
+	// for a member when it unsubscribes are handed to the other members, the
+	// last member delivers them itself. Every member has a single worker, an
+	// error wrapping ErrUnsupportedOption is returned for WithWorkers and
+	// WithPartitionKey.
+	SubscribeGroup(group string, sub Subscriber[E], opts ...SubscribeOption[E]) (Subscription, error)
 }
 
 // WorkerBusSingletonQueueSize - Size of the queue used by the WorkerBus singletons
 var WorkerBusSingletonQueueSize = 1000
 
-var (
-	workerBusMtx = &sync.Mutex{}
-	workerBusses = map[string]WorkerBus[any]{}
-)
-
 // GetNamedWorkerBus - Provides thread-safe access to a WorkerBus singleton with
 // a specified name. Repeated calls with the same name always return the same WorkerBus.
+// Panics if the name was registered with a different message type, see
+// GetNamedTypedWorkerBus.
 func GetNamedWorkerBus(name string) WorkerBus[any] {
-	workerBusMtx.Lock()
-	defer workerBusMtx.Unlock()
-	if b, ok := workerBusses[name]; ok {
-		return b
-	}
-	b := NewWorkerBus[any](WorkerBusSingletonQueueSize)
-	workerBusses[name] = b
-	return b
+	return MustGetNamedTypedWorkerBus[any](name)
 }
 
 var (
@@ -53,27 +112,85 @@ func GetWorkerBus() WorkerBus[any] {
 }
 
 type workerBusImpl[E any] struct {
-	subMtx *sync.RWMutex
-	subs   []*subWithQueue[E]
-	q      chan E
-	qLen   int
-	seq    int64
+	subMtx  *sync.Mutex                        // serializes writers of subs
+	subs    atomic.Pointer[[]*subWithQueue[E]] // immutable snapshot, replaced on every change
+	subsWg  *sync.WaitGroup                    // running sub workers
+	stopped bool                               // set by worker once q is closed and drained
+	q       [NumPriorities]chan queued[E]      // one lane per Priority
+	picker  lanePicker                         // used by worker only
+	qLen    int
+	flushes chan chan []<-chan struct{} // Flush requests, answered with the barriers to wait for
+	seq     int64
+	opts    options[E]
+	sched   *scheduler[E]
+
+	groups map[string]*queueGroup[E] // guarded by subMtx
+
+	published        atomic.Uint64
+	retiredDelivered atomic.Uint64 // counters of Subscribers whose workers stopped
+	retiredDropped   atomic.Uint64
+
+	closeMtx  *sync.RWMutex
+	closeOnce *sync.Once
+	closed    bool
+	closing   chan struct{}   // closed when Close or Drain is called
+	drained   chan struct{}   // closed when all sub workers have finished
+	inflight  *sync.WaitGroup // publishes that passed the closed check
 }
 
-func NewWorkerBus[E any](queueLen int) WorkerBus[E] {
+// NewWorkerBus creates a WorkerBus whose queue, and the queue of each of its
+// Subscribers, holds up to queueLen messages. A panicking Subscriber does not
+// stop its worker, see WithPanicHandler and WithMaxPanics.
+func NewWorkerBus[E any](queueLen int, opts ...WorkerBusOption[E]) WorkerBus[E] {
 	b := &workerBusImpl[E]{
-		subMtx: &sync.RWMutex{},
-		subs:   []*subWithQueue[E]{},
-		q:      make(chan E, queueLen),
-		qLen:   queueLen,
-		seq:    0,
+		subMtx:  &sync.Mutex{},
+		subsWg:  &sync.WaitGroup{},
+		groups:  map[string]*queueGroup[E]{},
+		flushes: make(chan chan []<-chan struct{}),
+		qLen:    queueLen,
+		seq:     0,
+		opts:    newOptions(opts, WorkerBusOption[E].applyWorkerBus),
+
+		closeMtx:  &sync.RWMutex{},
+		closeOnce: &sync.Once{},
+		closing:   make(chan struct{}),
+		drained:   make(chan struct{}),
+		inflight:  &sync.WaitGroup{},
+	}
+	for l := range b.q {
+		b.q[l] = make(chan queued[E], queueLen)
 	}
+	b.picker = lanePicker{policy: b.opts.priority}
+	b.subs.Store(&[]*subWithQueue[E]{})
+	b.sched = newScheduler(b)
 	go b.worker()
 	return b
 }
 
+// DrainOnShutdown registers b with a ShutdownContext, see
+// signal.GetShutdownContext. Once the context is cancelled, b is drained
+// while waiting up to timeout for queued messages to be delivered.
+func DrainOnShutdown[E any](ctx context.Context, b WorkerBus[E], timeout time.Duration) error {
+	return signal.RegisterOnShutdownCallback(ctx, func() {
+		drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_ = b.Drain(drainCtx)
+	})
+}
+
 func (b *workerBusImpl[E]) Publish(msg E) {
-	b.q <- msg
+	_ = b.publish(context.Background(), msg, PriorityNormal, nil)
+}
+
+func (b *workerBusImpl[E]) PublishWithPriority(msg E, prio Priority) {
+	_ = b.publish(context.Background(), msg, prio.clamp(), nil)
+}
+
+func (b *workerBusImpl[E]) PublishContext(ctx context.Context, msg E) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.publish(ctx, msg, PriorityNormal, nil)
 }
 
 // PublishTimeout publishes a message on the Bus, waiting up to timeout for
@@ -85,58 +202,510 @@ func (b *workerBusImpl[E]) PublishTimeout(msg E, timeout time.Duration) bool {
 	}
 	t := time.NewTimer(timeout)
 	defer t.Stop()
+	return b.publish(context.Background(), msg, PriorityNormal, t.C) == nil
+}
+
+func (b *workerBusImpl[E]) PublishAfter(msg E, d time.Duration) Scheduled {
+	return b.sched.schedule(msg, time.Now().Add(d))
+}
+
+func (b *workerBusImpl[E]) PublishAt(msg E, t time.Time) Scheduled {
+	return b.sched.schedule(msg, t)
+}
+
+// publish passes msg through the publish interceptors and enqueues it, see
+// enqueue. A message that is dropped by an interceptor counts as published.
+func (b *workerBusImpl[E]) publish(ctx context.Context, msg E, prio Priority, cancel <-chan time.Time) error {
+	if len(b.opts.publishInterceptors) == 0 {
+		return b.enqueue(ctx, msg, prio, cancel)
+	}
+	var err error
+	b.opts.interceptPublish(0, msg, func(msg E) {
+		err = b.enqueue(ctx, msg, prio, cancel)
+	})
+	return err
+}
+
+// enqueue enqueues msg in the lane of prio unless the bus is closed. Blocks
+// until there is space in the lane, the bus is closed, cancel fires or ctx
+// ends.
+func (b *workerBusImpl[E]) enqueue(ctx context.Context, msg E, prio Priority, cancel <-chan time.Time) error {
+	b.closeMtx.RLock()
+	if b.closed {
+		b.closeMtx.RUnlock()
+		return ErrClosed
+	}
+	b.inflight.Add(1)
+	b.closeMtx.RUnlock()
+	defer b.inflight.Done()
+	m := queued[E]{msg: msg}
+	if ctx != context.Background() {
+		m.ctx = context.WithoutCancel(ctx)
+	}
 	select {
-	case b.q <- msg:
-		return true
-	case <-t.C:
-		return false
+	case b.q[prio] <- m:
+		b.published.Add(1)
+		return nil
+	case <-b.closing:
+		return ErrClosed
+	case <-cancel:
+		return ErrQueueFull
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrQueueFull, ctx.Err())
+	}
+}
+
+func (b *workerBusImpl[E]) Close() error {
+	return b.Drain(context.Background())
+}
+
+func (b *workerBusImpl[E]) Drain(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		b.closeMtx.Lock()
+		b.closed = true
+		close(b.closing)
+		b.closeMtx.Unlock()
+		go func() {
+			b.inflight.Wait() // no publish can send on q after this
+			for _, lane := range b.q {
+				close(lane) // worker delivers what is left, then stops
+			}
+		}()
+	})
+	select {
+	case <-b.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *workerBusImpl[E]) Flush(ctx context.Context) error {
+	barriers := make(chan []<-chan struct{}, 1)
+	select {
+	case b.flushes <- barriers:
+	case <-b.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+	for _, done := range <-barriers {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
 }
 
 func (b *workerBusImpl[E]) Subscribe(sub Subscriber[E]) (unsubscribe func()) {
+	return b.SubscribeWithOptions(sub).Unsubscribe
+}
+
+func (b *workerBusImpl[E]) SubscribeWithOptions(sub Subscriber[E], opts ...SubscribeOption[E]) Subscription {
+	return b.subscribe(opts, func(s *subWithQueue[E]) { s.sub = sub })
+}
+
+func (b *workerBusImpl[E]) subscribeContextWithOptions(sub ContextSubscriber[E], opts []SubscribeOption[E]) Subscription {
+	return b.subscribe(opts, func(s *subWithQueue[E]) { s.ctxSub = sub })
+}
+
+// subscribe adds a subscriber whose Subscriber is set by set before its
+// workers start.
+func (b *workerBusImpl[E]) subscribe(opts []SubscribeOption[E], set func(s *subWithQueue[E])) Subscription {
+	o := newSubscribeOptions(opts)
 	b.subMtx.Lock()
 	defer b.subMtx.Unlock()
 	b.seq++
-	s := &subWithQueue[E]{id: b.seq, sub: sub, q: make(chan E, b.qLen)}
-	go s.work() // start worker for this sub
-	b.subs = append(b.subs, s)
-	return b.unsubscribeId(b.seq)
+	s := newSubWithQueue(b, b.seq, nil, o)
+	set(s)
+	if b.stopped {
+		close(s.done) // never receives anything
+		return s
+	}
+	s.start()
+	b.addSub(s)
+	b.subscribed()
+	return s
+}
+
+func (b *workerBusImpl[E]) SubscribeWithRetry(sub ErrorSubscriber[E], opts ...SubscribeOption[E]) Subscription {
+	o := newSubscribeOptions(opts)
+	return b.subscribe(opts, func(s *subWithQueue[E]) {
+		s.sub = retrying(sub, o.retry, o.deadLetters, b.closing, s.stopping)
+	})
 }
 
 func (b *workerBusImpl[E]) unsubscribeId(id int64) (unsubscribe func()) {
 	return func() {
 		b.subMtx.Lock()
 		defer b.subMtx.Unlock()
-		var subs []*subWithQueue[E]
-		for _, sub := range b.subs {
-			if sub.id != id {
-				subs = append(subs, sub)
-			} else {
-				close(sub.q) // close subs channel with stop its worker
-			}
+		b.removeSub(id)
+	}
+}
+
+// subscribed starts publishing the messages restored from the schedule file
+// once there is a Subscriber to receive them. Must be called with subMtx held.
+func (b *workerBusImpl[E]) subscribed() {
+	if b.opts.scheduleFile != "" {
+		b.sched.start()
+	}
+}
+
+// addSub adds s to the subscribers the worker delivers to. Must be called
+// with subMtx held.
+func (b *workerBusImpl[E]) addSub(s *subWithQueue[E]) {
+	old := *b.subs.Load()
+	subs := make([]*subWithQueue[E], len(old), len(old)+1)
+	copy(subs, old)
+	subs = append(subs, s)
+	b.subs.Store(&subs)
+}
+
+// removeSub removes the subscriber with the given id and closes it. Must be
+// called with subMtx held.
+func (b *workerBusImpl[E]) removeSub(id int64) {
+	old := *b.subs.Load()
+	subs := make([]*subWithQueue[E], 0, len(old))
+	for _, sub := range old {
+		if sub.id != id {
+			subs = append(subs, sub)
+		} else {
+			sub.close() // stops its workers once the queues are empty
+		}
+	}
+	b.subs.Store(&subs)
+}
+
+func (b *workerBusImpl[E]) Stats() Stats {
+	stats := Stats{
+		Published: b.published.Load(),
+		Delivered: b.retiredDelivered.Load(),
+		Dropped:   b.retiredDropped.Load(),
+	}
+	for _, lane := range b.q {
+		stats.Queued += len(lane)
+	}
+	for _, sub := range *b.subs.Load() {
+		if sub.members == nil {
+			stats.Subscriptions = append(stats.Subscriptions, sub.stats())
+			continue
+		}
+		sub.members.mtx.Lock()
+		for _, m := range sub.members.members {
+			stats.Subscriptions = append(stats.Subscriptions, m.stats())
 		}
-		b.subs = subs
+		sub.members.mtx.Unlock()
 	}
+	stats.Subscribers = len(stats.Subscriptions)
+	for _, s := range stats.Subscriptions {
+		stats.Delivered += s.Delivered
+		stats.Dropped += s.Dropped
+	}
+	return stats
 }
 
 func (b *workerBusImpl[E]) worker() {
-	for msg := range b.q {
-		b.subMtx.RLock()
-		for _, sub := range b.subs {
-			sub.q <- msg // multiplex message to all sub-queues
+	lanes := b.q // set to nil once closed and drained
+	for open := len(lanes); open > 0; {
+		var ready [NumPriorities]bool
+		waiting := false
+		for l, lane := range lanes {
+			ready[l] = len(lane) > 0
+			waiting = waiting || ready[l]
+		}
+		if waiting {
+			select {
+			case barriers := <-b.flushes: // must not wait until the lanes are empty
+				b.flush(barriers)
+			default:
+				prio := b.picker.pick(&ready)
+				b.dispatch(<-lanes[prio], prio)
+			}
+			continue
+		}
+		var (
+			msg  queued[E]
+			prio Priority
+			ok   bool
+		)
+		select {
+		case msg, ok = <-lanes[PriorityHigh]:
+			prio = PriorityHigh
+		case msg, ok = <-lanes[PriorityNormal]:
+			prio = PriorityNormal
+		case msg, ok = <-lanes[PriorityLow]:
+			prio = PriorityLow
+		case barriers := <-b.flushes:
+			b.flush(barriers)
+			continue
+		}
+		if !ok {
+			lanes[prio] = nil
+			open--
+			continue
+		}
+		b.dispatch(msg, prio)
+	}
+	b.shutdown()
+}
+
+// flush dispatches the messages that are queued and answers a Flush request
+// with the barriers of all sub-queues.
+func (b *workerBusImpl[E]) flush(barriers chan<- []<-chan struct{}) {
+	// every message published before Flush was called is in q by now
+	for l := NumPriorities - 1; l >= 0; l-- {
+		for n := len(b.q[l]); n > 0; n-- {
+			b.dispatch(<-b.q[l], Priority(l))
+		}
+	}
+	var all []<-chan struct{}
+	for _, sub := range *b.subs.Load() {
+		all = sub.barriers(all)
+	}
+	barriers <- all
+}
+
+// dispatch multiplexes msg to all sub-queues.
+func (b *workerBusImpl[E]) dispatch(msg queued[E], prio Priority) {
+	for _, sub := range *b.subs.Load() {
+		if !sub.push(msg, prio) {
+			sub.Unsubscribe() // overflowed with policy Disconnect
 		}
-		b.subMtx.RUnlock()
 	}
 }
 
+// shutdown stops the sub workers once q was closed and drained.
+func (b *workerBusImpl[E]) shutdown() {
+	// q was closed and everything in it is delivered to the sub-queues, stop the
+	// sub workers once they have worked off their queues
+	b.subMtx.Lock()
+	b.stopped = true
+	for _, sub := range *b.subs.Load() {
+		sub.close()
+	}
+	b.subs.Store(&[]*subWithQueue[E]{})
+	b.subMtx.Unlock()
+	b.subsWg.Wait()
+	b.sched.running.Wait() // has persisted the messages it could not publish
+	close(b.drained)
+}
+
+// queued is a message in the queues of a WorkerBus together with the context
+// it was published with, nil if there was none.
+type queued[E any] struct {
+	ctx context.Context
+	msg E
+}
+
 type subWithQueue[E any] struct {
-	id  int64
-	sub Subscriber[E]
-	q   chan E
+	id       int64
+	sub      Subscriber[E]
+	ctxSub   ContextSubscriber[E] // replaces sub if set
+	qs       []*queue[queued[E]]  // one queue per worker
+	key      func(msg E) uint64
+	next     int // round-robin index used if there is no key
+	b        *workerBusImpl[E]
+	members  *queueGroup[E] // set if this dispatches to the members of a group
+	group    *queueGroup[E] // set if this is a member of a group
+	panics   atomic.Int64
+	disabled atomic.Bool
+
+	delivered atomic.Uint64
+	latency   *latencyRecorder              // nil unless WithLatencyStats is set
+	running   atomic.Int32                  // workers that have not stopped yet
+	done      chan struct{}                 // closed once all workers stopped
+	pauseMtx  *sync.Mutex                   // serializes Pause and Resume
+	resume    atomic.Pointer[chan struct{}] // set while paused, closed by Resume
+	stopping  chan struct{}                 // closed once the queues are closed
+	stopOnce  *sync.Once
+}
+
+func newSubWithQueue[E any](b *workerBusImpl[E], id int64, sub Subscriber[E], o subscribeOptions[E]) *subWithQueue[E] {
+	s := &subWithQueue[E]{
+		id:       id,
+		sub:      sub,
+		key:      o.key,
+		b:        b,
+		latency:  newLatencyRecorder(b.opts.latencyStats),
+		done:     make(chan struct{}),
+		pauseMtx: &sync.Mutex{},
+		stopping: make(chan struct{}),
+		stopOnce: &sync.Once{},
+	}
+	for i := 0; i < o.workers; i++ {
+		s.qs = append(s.qs, newQueue[queued[E]](b.qLen, o.policy, o.timeout, b.opts.priority))
+	}
+	return s
+}
+
+// start starts one worker per queue. Must be called with subMtx held.
+func (s *subWithQueue[E]) start() {
+	s.b.subsWg.Add(len(s.qs))
+	s.running.Store(int32(len(s.qs)))
+	for _, q := range s.qs {
+		go s.work(q)
+	}
+}
+
+func (s *subWithQueue[E]) Unsubscribe() {
+	if s.group != nil {
+		s.group.leave(s)
+		return
+	}
+	s.b.unsubscribeId(s.id)()
+}
+
+func (s *subWithQueue[E]) Dropped() (dropped uint64) {
+	for _, q := range s.qs {
+		dropped += q.dropped.Load()
+	}
+	return dropped
+}
+
+func (s *subWithQueue[E]) Pause() {
+	s.pauseMtx.Lock()
+	defer s.pauseMtx.Unlock()
+	if s.resume.Load() == nil {
+		resume := make(chan struct{})
+		s.resume.Store(&resume)
+	}
 }
 
-func (s *subWithQueue[E]) work() {
-	for msg := range s.q {
-		s.sub(msg)
+func (s *subWithQueue[E]) Resume() {
+	s.pauseMtx.Lock()
+	defer s.pauseMtx.Unlock()
+	if resume := s.resume.Load(); resume != nil {
+		close(*resume)
+		s.resume.Store(nil)
+	}
+}
+
+func (s *subWithQueue[E]) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *subWithQueue[E]) Stats() SubscriptionStats {
+	return SubscriptionStats{Delivered: s.delivered.Load(), Dropped: s.Dropped()}
+}
+
+// stats returns the counters of s as reported by WorkerBus.Stats.
+func (s *subWithQueue[E]) stats() SubscriberStats {
+	stats := SubscriberStats{
+		Id:        s.id,
+		Delivered: s.delivered.Load(),
+		Dropped:   s.Dropped(),
+		Panics:    s.panics.Load(),
+		Latency:   s.latency.snapshot(),
+	}
+	for _, q := range s.qs {
+		stats.Queued += q.len()
+	}
+	return stats
+}
+
+// push enqueues msg into the queue of the worker msg is partitioned to.
+// Returns false if the Subscriber has to be disconnected.
+func (s *subWithQueue[E]) push(msg queued[E], prio Priority) bool {
+	if s.members != nil {
+		return s.members.push(msg, prio)
+	}
+	if len(s.qs) == 1 {
+		return !s.qs[0].overflowed(s.qs[0].push(msg, prio))
+	}
+	var i int
+	if s.key != nil {
+		i = int(s.key(msg.msg) % uint64(len(s.qs)))
+	} else {
+		i = s.next
+		s.next = (s.next + 1) % len(s.qs)
+	}
+	return !s.qs[i].overflowed(s.qs[i].push(msg, prio))
+}
+
+// barriers appends the barriers of the queues of s, or of its members, to
+// barriers, see queue.barrier.
+func (s *subWithQueue[E]) barriers(barriers []<-chan struct{}) []<-chan struct{} {
+	if s.members != nil {
+		s.members.mtx.Lock()
+		defer s.members.mtx.Unlock()
+		for _, m := range s.members.members {
+			barriers = m.barriers(barriers)
+		}
+		return barriers
+	}
+	for _, q := range s.qs {
+		barriers = append(barriers, q.barrier())
+	}
+	return barriers
+}
+
+func (s *subWithQueue[E]) close() {
+	if s.members != nil {
+		s.members.close()
+		return
+	}
+	for _, q := range s.qs {
+		q.close()
+	}
+	s.stop()
+}
+
+// stop wakes up paused workers once the queues are closed, so that they
+// deliver what is left and stop.
+func (s *subWithQueue[E]) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+	})
+}
+
+// awaitResume blocks while s is paused, unless its queues are closed or the
+// bus is closing.
+func (s *subWithQueue[E]) awaitResume() {
+	resume := s.resume.Load()
+	if resume == nil {
+		return
+	}
+	select {
+	case <-*resume:
+	case <-s.stopping:
+	case <-s.b.closing:
+	}
+}
+
+// deliver delivers msg like options.deliver and updates the counters of s.
+func (s *subWithQueue[E]) deliver(msg queued[E]) bool {
+	if s.latency == nil {
+		return s.b.opts.deliverTo(s.id, s.sub, s.ctxSub, msg.ctx, msg.msg, &s.delivered)
+	}
+	start := time.Now()
+	ok := s.b.opts.deliverTo(s.id, s.sub, s.ctxSub, msg.ctx, msg.msg, &s.delivered)
+	s.latency.observe(time.Since(start))
+	return ok
+}
+
+func (s *subWithQueue[E]) work(q *queue[queued[E]]) {
+	defer s.b.subsWg.Done()
+	defer func() {
+		if s.running.Add(-1) == 0 {
+			s.b.retiredDelivered.Add(s.delivered.Load())
+			s.b.retiredDropped.Add(s.Dropped())
+			close(s.done)
+		}
+	}()
+	for {
+		msg, ok := q.pop()
+		if !ok {
+			return
+		}
+		if s.disabled.Load() {
+			continue // drain until unsubscribe closes the queue
+		}
+		s.awaitResume()
+		if !s.deliver(msg) && s.b.opts.exceedsMaxPanics(s.panics.Add(1)) {
+			s.disabled.Store(true)
+			s.Unsubscribe()
+		}
 	}
 }
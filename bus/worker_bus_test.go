@@ -1,10 +1,16 @@
 package bus
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/jjxxs/gopher-tools/signal"
 )
 
 /**
@@ -99,6 +105,466 @@ func TestMultiWorkerBusReceiverShouldNotReceivePublishMessageAfterUnsubscribe(t
 	}
 }
 
+func TestWorkerBusPanickingSubscriberKeepsWorking(t *testing.T) {
+	panics := make(chan any, 10)
+	b := NewWorkerBus[int](10, WithPanicHandler(func(msg int, subscriberId int64, r any, stack []byte) {
+		panics <- r
+	}))
+	c := make(chan int, 10)
+	b.Subscribe(func(msg int) {
+		if msg == 0 {
+			panic("boom")
+		}
+		c <- msg
+	})
+	b.Publish(0)
+	b.Publish(1)
+	select {
+	case r := <-panics:
+		if r != "boom" {
+			t.Fatalf("unexpected recovered value %v", r)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("panic handler was not called")
+	}
+	select {
+	case <-c:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("subscriber stopped receiving after a panic")
+	}
+}
+
+func TestWorkerBusMaxPanicsUnsubscribes(t *testing.T) {
+	b := NewWorkerBus[int](10, WithPanicHandler(func(int, int64, any, []byte) {}), WithMaxPanics[int](1))
+	var calls atomic.Int32
+	b.Subscribe(func(int) {
+		calls.Add(1)
+		panic("boom")
+	})
+	for i := 0; i < 5; i++ {
+		b.Publish(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if calls.Load() != 1 {
+		t.Fatalf("expected subscriber to be unsubscribed after 1 panic, was called %d times", calls.Load())
+	}
+	if len(*b.(*workerBusImpl[int]).subs.Load()) != 0 {
+		t.Fatal("expected subscriber to be removed")
+	}
+}
+
+func TestWorkerBusCloseDeliversQueuedMessages(t *testing.T) {
+	b := NewWorkerBus[int](100)
+	var count atomic.Int32
+	for i := 0; i < 3; i++ {
+		b.Subscribe(func(int) {
+			time.Sleep(time.Millisecond)
+			count.Add(1)
+		})
+	}
+	for i := 0; i < 50; i++ {
+		b.Publish(i)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if count.Load() != 150 {
+		t.Fatalf("expected 150 deliveries after Close, got %d", count.Load())
+	}
+}
+
+func TestWorkerBusRejectsPublishAfterClose(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	var count atomic.Int32
+	b.Subscribe(func(int) { count.Add(1) })
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b.Publish(1)
+	if b.PublishTimeout(1, 10*time.Millisecond) {
+		t.Fatal("expected PublishTimeout to return false on a closed bus")
+	}
+	unsubscribe := b.Subscribe(func(int) { count.Add(1) })
+	unsubscribe()
+	if err := b.Close(); err != nil { // must be idempotent
+		t.Fatal(err)
+	}
+	if count.Load() != 0 {
+		t.Fatalf("expected no deliveries, got %d", count.Load())
+	}
+}
+
+func TestWorkerBusDrainReturnsContextErrorWhenSubscriberBlocks(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	block := make(chan struct{})
+	b.Subscribe(func(int) { <-block })
+	b.Publish(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	close(block)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkerBusCloseUnblocksPendingPublish(t *testing.T) {
+	b := NewWorkerBus[int](1)
+	block := make(chan struct{})
+	b.Subscribe(func(int) { <-block })
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ { // saturates the queues and blocks
+			b.Publish(i)
+		}
+		close(published)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_ = b.Drain(ctx)
+	select {
+	case <-published:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Publish stayed blocked after the bus was closed")
+	}
+	close(block)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkerBusDrainOnShutdown(t *testing.T) {
+	ctx, cancel := signal.GetShutdownContext(context.Background())
+	b := NewWorkerBus[int](10)
+	var count atomic.Int32
+	b.Subscribe(func(int) { count.Add(1) })
+	if err := DrainOnShutdown(ctx, b, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		b.Publish(i)
+	}
+	cancel()
+	if err := signal.WaitForShutdownContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count.Load() != 10 {
+		t.Fatalf("expected 10 deliveries before shutdown completed, got %d", count.Load())
+	}
+	if b.PublishTimeout(1, 10*time.Millisecond) {
+		t.Fatal("expected bus to be closed after shutdown")
+	}
+}
+
+// blockedSubscriber subscribes a Subscriber that blocks on its first message
+// until release is closed, and waits until the first message arrived.
+func blockedSubscriber(t *testing.T, b WorkerBus[int], release chan struct{}, opts ...SubscribeOption[int]) (Subscription, chan int) {
+	received := make(chan int, 100)
+	started := make(chan struct{})
+	once := sync.Once{}
+	s := b.SubscribeWithOptions(func(msg int) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		received <- msg
+	}, opts...)
+	b.Publish(-1)
+	select {
+	case <-started:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("subscriber did not start")
+	}
+	return s, received
+}
+
+func TestWorkerBusSlowSubscriberDoesNotStallOthers(t *testing.T) {
+	b := NewWorkerBus[int](2)
+	release := make(chan struct{})
+	defer close(release)
+	_, _ = blockedSubscriber(t, b, release, WithOverflowPolicy[int](DropNewest))
+	c := make(chan int, 100)
+	b.Subscribe(func(msg int) { c <- msg })
+	for i := 0; i < 20; i++ {
+		b.Publish(i)
+	}
+	for count := 0; count < 20; count++ {
+		select {
+		case <-c:
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("fast subscriber stalled after %d messages", count)
+		}
+	}
+}
+
+func TestWorkerBusOverflowDropNewest(t *testing.T) {
+	b := NewWorkerBus[int](2)
+	release := make(chan struct{})
+	s, received := blockedSubscriber(t, b, release, WithOverflowPolicy[int](DropNewest))
+	for i := 0; i < 5; i++ {
+		b.Publish(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := drainInts(received); fmt.Sprint(got) != "[-1 0 1]" {
+		t.Fatalf("unexpected messages: %v", got)
+	}
+	if s.Dropped() != 3 {
+		t.Fatalf("expected 3 dropped messages, got %d", s.Dropped())
+	}
+}
+
+func TestWorkerBusOverflowDropOldest(t *testing.T) {
+	b := NewWorkerBus[int](2)
+	release := make(chan struct{})
+	s, received := blockedSubscriber(t, b, release, WithOverflowPolicy[int](DropOldest))
+	for i := 0; i < 5; i++ {
+		b.Publish(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := drainInts(received); fmt.Sprint(got) != "[-1 3 4]" {
+		t.Fatalf("unexpected messages: %v", got)
+	}
+	if s.Dropped() != 3 {
+		t.Fatalf("expected 3 dropped messages, got %d", s.Dropped())
+	}
+}
+
+func TestWorkerBusOverflowBlockWithTimeout(t *testing.T) {
+	b := NewWorkerBus[int](1)
+	release := make(chan struct{})
+	s, received := blockedSubscriber(t, b, release, WithOverflowTimeout[int](10*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		b.Publish(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := drainInts(received); fmt.Sprint(got) != "[-1 0]" {
+		t.Fatalf("unexpected messages: %v", got)
+	}
+	if s.Dropped() != 2 {
+		t.Fatalf("expected 2 dropped messages, got %d", s.Dropped())
+	}
+}
+
+func TestWorkerBusOverflowDisconnect(t *testing.T) {
+	b := NewWorkerBus[int](1)
+	release := make(chan struct{})
+	s, received := blockedSubscriber(t, b, release, WithOverflowPolicy[int](Disconnect))
+	for i := 0; i < 3; i++ {
+		b.Publish(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if len(*b.(*workerBusImpl[int]).subs.Load()) != 0 {
+		t.Fatal("expected subscriber to be disconnected")
+	}
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := drainInts(received); fmt.Sprint(got) != "[-1 0]" {
+		t.Fatalf("unexpected messages: %v", got)
+	}
+	if s.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped message, got %d", s.Dropped())
+	}
+}
+
+func TestWorkerBusWorkersRunConcurrently(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	var running, maxRunning atomic.Int32
+	b.SubscribeWithOptions(func(int) {
+		n := running.Add(1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+	}, WithWorkers[int](4))
+	for i := 0; i < 8; i++ {
+		b.Publish(i)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning.Load() < 2 {
+		t.Fatalf("expected messages to be handled concurrently, max concurrency was %d", maxRunning.Load())
+	}
+}
+
+func TestWorkerBusPartitionKeyKeepsOrderPerKey(t *testing.T) {
+	type event struct {
+		entity string
+		seq    int
+	}
+	b := NewWorkerBus[event](1000)
+	mtx := sync.Mutex{}
+	seen := map[string][]int{}
+	b.SubscribeWithOptions(func(e event) {
+		time.Sleep(time.Duration(e.seq%3) * 100 * time.Microsecond)
+		mtx.Lock()
+		seen[e.entity] = append(seen[e.entity], e.seq)
+		mtx.Unlock()
+	}, WithWorkers[event](4), WithPartitionKey(func(e event) string { return e.entity }))
+	entities := []string{"a", "b", "c", "d", "e", "f"}
+	for i := 0; i < 50; i++ {
+		for _, entity := range entities {
+			b.Publish(event{entity, i})
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, entity := range entities {
+		seqs := seen[entity]
+		if len(seqs) != 50 {
+			t.Fatalf("entity %s: expected 50 messages, got %d", entity, len(seqs))
+		}
+		for i, seq := range seqs {
+			if seq != i {
+				t.Fatalf("entity %s: messages out of order: %v", entity, seqs)
+			}
+		}
+	}
+}
+
+func TestWorkerBusFlushWaitsForDelivery(t *testing.T) {
+	b := NewWorkerBus[int](100)
+	defer func() { _ = b.Close() }()
+	var slow, fast, grouped atomic.Int32
+	b.Subscribe(func(int) {
+		time.Sleep(time.Millisecond)
+		slow.Add(1)
+	})
+	b.SubscribeWithOptions(func(int) { fast.Add(1) }, WithWorkers[int](4))
+	b.SubscribeGroup("group", func(int) { grouped.Add(1) })
+	b.SubscribeGroup("group", func(int) { grouped.Add(1) })
+
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				b.Publish(i)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if slow.Load() != 40 || fast.Load() != 40 || grouped.Load() != 40 {
+		t.Fatalf("expected all messages to be delivered, got %d, %d and %d", slow.Load(), fast.Load(), grouped.Load())
+	}
+	b.Publish(40) // the bus keeps running
+	if err := b.Flush(context.Background()); err != nil || slow.Load() != 41 {
+		t.Fatalf("expected the bus to keep delivering, got %v and %d", err, slow.Load())
+	}
+}
+
+func TestWorkerBusFlushReturnsContextError(t *testing.T) {
+	b := NewWorkerBus[int](10)
+	release := make(chan struct{})
+	_, received := blockedSubscriber(t, b, release)
+	b.Publish(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	close(release)
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := drainInts(received); len(msgs) != 2 {
+		t.Fatalf("expected both messages after Flush, got %v", msgs)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("expected Flush on a closed bus to return nil, got %v", err)
+	}
+}
+
+func TestWorkerBusFlushCountsDroppedMessages(t *testing.T) {
+	b := NewWorkerBus[int](2)
+	defer func() { _ = b.Close() }()
+	release := make(chan struct{})
+	blockedSubscriber(t, b, release, WithOverflowPolicy[int](DropOldest))
+	for i := 0; i < 5; i++ {
+		b.Publish(i)
+	}
+	done := make(chan error)
+	go func() { done <- b.Flush(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Flush to return once the queued messages were handled")
+	}
+}
+
+func TestWorkerBusFlushUnderLoad(t *testing.T) {
+	b := NewWorkerBus[int](100)
+	b.Subscribe(func(msg int) { time.Sleep(50 * time.Microsecond) })
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				b.Publish(i)
+			}
+		}
+	}()
+	time.Sleep(20 * time.Millisecond) // the lanes are never empty from here on
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := b.Flush(ctx)
+	close(stop)
+	<-stopped
+	_ = b.Close()
+	if err != nil {
+		t.Fatalf("expected Flush to return while messages are published, got %v", err)
+	}
+}
+
+func drainInts(c chan int) (msgs []int) {
+	for {
+		select {
+		case msg := <-c:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
 /**
  * PublishTimeout edge cases (regression coverage for the Ticker→Timer fix).
  */
@@ -0,0 +1,417 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jjxxs/gopher-tools/bus"
+)
+
+// ErrBridgeClosed is returned by Bridge.Attach after the Bridge was closed.
+var ErrBridgeClosed = errors.New("bridge is closed")
+
+// A Bridge forwards the messages of a bus.Bus to remote peers and publishes
+// the messages it receives from remote peers on the bus.Bus. Messages are
+// encoded with a bus.Codec, one message per websocket message.
+//
+// A message received from a peer is never sent back to that peer, so two
+// processes can bridge their buses in both directions over one Connection.
+// Bridges must not form cycles of three or more processes though, as a
+// message would then circle forever.
+type Bridge[E any] interface {
+	// Attach starts forwarding the messages of the bus.Bus to conn. Every peer
+	// has its own queue, so a slow peer does not hold back the others unless
+	// its OverflowPolicy is bus.Block. Unsubscribing the returned Subscription
+	// detaches the peer without closing conn. An error is returned if a topic
+	// pattern is malformed or if the Bridge is closed.
+	Attach(conn Connection, opts ...PeerOption[E]) (bus.Subscription, error)
+
+	// OnMessage decodes data and publishes it on the bus.Bus. Pass it as
+	// onMessage to NewConnection for every peer whose messages should be
+	// published.
+	OnMessage(conn Connection, msgType int, data []byte)
+
+	// OnClose detaches conn. Pass it as onClose to NewConnection.
+	OnClose(conn Connection, code int, text string)
+
+	// Close detaches all peers and stops forwarding. Connections are not closed.
+	Close()
+}
+
+// A BridgeOption configures a Bridge.
+type BridgeOption[E any] func(o *bridgeOptions[E])
+
+type bridgeOptions[E any] struct {
+	codec   bus.Codec[E]
+	msgType int
+	topic   func(msg E) string
+	onError func(conn Connection, err error)
+}
+
+// WithBridgeCodec sets the Codec that messages are sent and received with. The
+// default is bus.JSONCodec, which suits browser clients.
+func WithBridgeCodec[E any](codec bus.Codec[E]) BridgeOption[E] {
+	return func(o *bridgeOptions[E]) {
+		o.codec = codec
+	}
+}
+
+// WithMessageType sets the websocket message type used for sending, e.g.
+// websocket.BinaryMessage for binary codecs. The default is
+// websocket.TextMessage.
+func WithMessageType[E any](msgType int) BridgeOption[E] {
+	return func(o *bridgeOptions[E]) {
+		o.msgType = msgType
+	}
+}
+
+// WithTopic sets the function that determines the topic of a message. It is
+// required to select messages by topic with WithPeerTopics.
+func WithTopic[E any](topic func(msg E) string) BridgeOption[E] {
+	return func(o *bridgeOptions[E]) {
+		o.topic = topic
+	}
+}
+
+// WithBridgeErrorHandler sets the function that is called if a message can not
+// be encoded, decoded or sent. conn is nil if the message could not be
+// encoded. By default, errors are logged.
+func WithBridgeErrorHandler[E any](onError func(conn Connection, err error)) BridgeOption[E] {
+	return func(o *bridgeOptions[E]) {
+		o.onError = onError
+	}
+}
+
+// A PeerOption configures a single peer of a Bridge.
+type PeerOption[E any] func(o *peerOptions[E])
+
+type peerOptions[E any] struct {
+	filter   func(msg E) bool
+	patterns []string
+	queueLen int
+	policy   bus.OverflowPolicy
+	timeout  time.Duration
+}
+
+// WithPeerFilter only forwards messages to the peer for which filter returns true.
+func WithPeerFilter[E any](filter func(msg E) bool) PeerOption[E] {
+	return func(o *peerOptions[E]) {
+		o.filter = filter
+	}
+}
+
+// WithPeerTopics only forwards messages to the peer whose topic matches one of
+// the given patterns, see bus.TopicBus for the syntax. The topic of a message
+// is determined by the function given to WithTopic.
+func WithPeerTopics[E any](patterns ...string) PeerOption[E] {
+	return func(o *peerOptions[E]) {
+		o.patterns = append(o.patterns, patterns...)
+	}
+}
+
+// WithPeerQueue sets the length of the peer's queue and the OverflowPolicy
+// that is applied if it is full. The default is a queue of 64 messages and
+// bus.DropOldest. bus.Disconnect closes the Connection of the peer.
+func WithPeerQueue[E any](queueLen int, policy bus.OverflowPolicy) PeerOption[E] {
+	return func(o *peerOptions[E]) {
+		o.queueLen = queueLen
+		o.policy = policy
+	}
+}
+
+// WithPeerTimeout sets the OverflowPolicy of the peer to bus.BlockWithTimeout
+// with the given timeout.
+func WithPeerTimeout[E any](timeout time.Duration) PeerOption[E] {
+	return func(o *peerOptions[E]) {
+		o.policy = bus.BlockWithTimeout
+		o.timeout = timeout
+	}
+}
+
+// originKey is the context key of the Connection a message was received from.
+type originKey struct{}
+
+type bridgeImpl[E any] struct {
+	b           bus.Bus[E]
+	opts        bridgeOptions[E]
+	unsubscribe func()
+
+	mtx    *sync.Mutex
+	peers  map[Connection]*peer[E]
+	closed bool
+}
+
+// NewBridge creates a Bridge that subscribes to b. The Bridge recognizes the
+// messages it published itself by the context they were published with, see
+// bus.PublishContext, so b must pass contexts on to its Subscribers, like a
+// bus.Bus created by bus.NewBus or a bus.WorkerBus do. Panics if b does not,
+// e.g. if it is a bus.ReplayBus or a bus.DurableBus.
+func NewBridge[E any](b bus.Bus[E], opts ...BridgeOption[E]) Bridge[E] {
+	o := bridgeOptions[E]{
+		codec:   bus.JSONCodec[E](),
+		msgType: websocket.TextMessage,
+		onError: func(conn Connection, err error) {
+			if conn != nil {
+				log.Printf("websocket: bridge to %s: %v", conn, err)
+			} else {
+				log.Printf("websocket: bridge: %v", err)
+			}
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if _, ok := b.(interface {
+		PublishContext(ctx context.Context, msg E) error
+	}); !ok {
+		panic("websocket: NewBridge requires a bus that passes contexts on to its Subscribers")
+	}
+	br := &bridgeImpl[E]{
+		b:     b,
+		opts:  o,
+		mtx:   &sync.Mutex{},
+		peers: map[Connection]*peer[E]{},
+	}
+	br.unsubscribe = bus.SubscribeWithContext(b, br.forward).Unsubscribe
+	return br
+}
+
+func (br *bridgeImpl[E]) Attach(conn Connection, opts ...PeerOption[E]) (bus.Subscription, error) {
+	o := peerOptions[E]{queueLen: 64, policy: bus.DropOldest}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	p := &peer[E]{
+		br:   br,
+		conn: conn,
+		opts: o,
+		out:  make(chan []byte, max(o.queueLen, 1)),
+		done: make(chan struct{}),
+	}
+	for _, pattern := range o.patterns {
+		tp, err := bus.ParseTopicPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		p.topics = append(p.topics, tp)
+	}
+	br.mtx.Lock()
+	defer br.mtx.Unlock()
+	if br.closed {
+		return nil, ErrBridgeClosed
+	}
+	if old, ok := br.peers[conn]; ok {
+		old.stop()
+	}
+	br.peers[conn] = p
+	go p.send()
+	return p, nil
+}
+
+func (br *bridgeImpl[E]) OnMessage(conn Connection, _ int, data []byte) {
+	msg, err := br.opts.codec.Decode(data)
+	if err != nil {
+		br.opts.onError(conn, err)
+		return
+	}
+	br.mtx.Lock()
+	closed := br.closed
+	br.mtx.Unlock()
+	if !closed {
+		_ = bus.PublishContext(context.WithValue(context.Background(), originKey{}, conn), br.b, msg)
+	}
+}
+
+func (br *bridgeImpl[E]) OnClose(conn Connection, _ int, _ string) {
+	br.detach(conn, nil)
+}
+
+func (br *bridgeImpl[E]) Close() {
+	br.mtx.Lock()
+	if br.closed {
+		br.mtx.Unlock()
+		return
+	}
+	br.closed = true
+	for conn, p := range br.peers {
+		p.stop()
+		delete(br.peers, conn)
+	}
+	br.mtx.Unlock()
+	br.unsubscribe()
+}
+
+// forward is the Subscriber of the Bridge. It sends msg to all peers that
+// select it, except to the peer msg was received from.
+func (br *bridgeImpl[E]) forward(ctx context.Context, msg E) {
+	data, err := br.opts.codec.Encode(msg)
+	if err != nil {
+		br.opts.onError(nil, err)
+		return
+	}
+	origin, _ := ctx.Value(originKey{}).(Connection)
+	br.mtx.Lock()
+	peers := make([]*peer[E], 0, len(br.peers))
+	for conn, p := range br.peers {
+		if conn != origin {
+			peers = append(peers, p)
+		}
+	}
+	br.mtx.Unlock()
+	for _, p := range peers {
+		if !p.selects(msg) {
+			continue
+		}
+		if p.paused.Load() {
+			p.skipped.Add(1)
+			continue
+		}
+		p.push(data)
+	}
+}
+
+// detach removes the peer of conn if it is p or if p is nil.
+func (br *bridgeImpl[E]) detach(conn Connection, p *peer[E]) {
+	br.mtx.Lock()
+	defer br.mtx.Unlock()
+	if cur, ok := br.peers[conn]; ok && (p == nil || cur == p) {
+		cur.stop()
+		delete(br.peers, conn)
+	}
+}
+
+type peer[E any] struct {
+	br      *bridgeImpl[E]
+	conn    Connection
+	opts    peerOptions[E]
+	topics  []bus.TopicPattern
+	out     chan []byte
+	done    chan struct{}
+	once    sync.Once
+	paused  atomic.Bool
+	sent    atomic.Uint64
+	skipped atomic.Uint64
+	dropped atomic.Uint64
+}
+
+func (p *peer[E]) Unsubscribe() {
+	p.br.detach(p.conn, p)
+}
+
+// Pause stops forwarding messages to the peer, messages published in the
+// meantime are skipped.
+func (p *peer[E]) Pause() {
+	p.paused.Store(true)
+}
+
+func (p *peer[E]) Resume() {
+	p.paused.Store(false)
+}
+
+func (p *peer[E]) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *peer[E]) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+func (p *peer[E]) Stats() bus.SubscriptionStats {
+	return bus.SubscriptionStats{Delivered: p.sent.Load(), Skipped: p.skipped.Load(), Dropped: p.dropped.Load()}
+}
+
+func (p *peer[E]) selects(msg E) bool {
+	if p.opts.filter != nil && !p.opts.filter(msg) {
+		return false
+	}
+	if len(p.topics) == 0 {
+		return true
+	}
+	if p.br.opts.topic == nil {
+		return false
+	}
+	topic := p.br.opts.topic(msg)
+	for _, tp := range p.topics {
+		if tp.Match(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// push queues data for the peer according to its OverflowPolicy.
+func (p *peer[E]) push(data []byte) {
+	select {
+	case p.out <- data:
+		return
+	case <-p.done:
+		return
+	default:
+	}
+	switch p.opts.policy {
+	case bus.Block:
+		select {
+		case p.out <- data:
+		case <-p.done:
+		}
+	case bus.DropNewest:
+		p.dropped.Add(1)
+	case bus.DropOldest:
+		for {
+			select {
+			case p.out <- data:
+				return
+			case <-p.done:
+				return
+			default:
+			}
+			select {
+			case <-p.out:
+				p.dropped.Add(1)
+			default:
+			}
+		}
+	case bus.BlockWithTimeout:
+		t := time.NewTimer(p.opts.timeout)
+		defer t.Stop()
+		select {
+		case p.out <- data:
+		case <-p.done:
+		case <-t.C:
+			p.dropped.Add(1)
+		}
+	case bus.Disconnect:
+		p.dropped.Add(1)
+		p.br.detach(p.conn, p)
+		p.conn.Close()
+	}
+}
+
+// send writes queued messages to the Connection until the peer is detached or
+// sending fails.
+func (p *peer[E]) send() {
+	for {
+		select {
+		case data := <-p.out:
+			if err := p.conn.Send(p.br.opts.msgType, data); err != nil {
+				p.br.opts.onError(p.conn, err)
+				p.br.detach(p.conn, p)
+				return
+			}
+			p.sent.Add(1)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *peer[E]) stop() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
@@ -0,0 +1,266 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jjxxs/gopher-tools/bus"
+)
+
+type event struct {
+	Topic string
+	N     int
+}
+
+func TestBridgeForwardsSelectedMessagesToPeer(t *testing.T) {
+	b := bus.NewBus[event]()
+	br := NewBridge(b, WithTopic(func(e event) string { return e.Topic }))
+	defer br.Close()
+	svrSideConns := serverAcceptConnectAt(t, t.Name(), nil, br.OnClose, nil)
+	clientMsgs, clientMsgHandler := getMessageStreamWithHandler(nil)
+	_ = clientConnectToServerAt(t, t.Name(), clientMsgHandler, nil, nil)
+	svrSideConn := waitForConnectionOrFail(t, svrSideConns, 100*time.Millisecond)
+	if _, err := br.Attach(svrSideConn, WithPeerTopics[event]("orders.>"),
+		WithPeerFilter(func(e event) bool { return e.N%2 == 0 })); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Publish(event{"orders.created", 1})
+	b.Publish(event{"orders.created", 2})
+	b.Publish(event{"users.created", 4})
+	b.Publish(event{"orders.deleted", 6})
+	for _, expected := range []string{`{"Topic":"orders.created","N":2}`, `{"Topic":"orders.deleted","N":6}`} {
+		msg := waitForMessageOrFail(t, clientMsgs, 100*time.Millisecond)
+		if msg.msgType != websocket.TextMessage || string(msg.data) != expected {
+			t.Fatalf("expected %s, got %s", expected, msg.data)
+		}
+	}
+}
+
+func TestBridgePublishesReceivedMessagesWithoutEcho(t *testing.T) {
+	b := bus.NewBus[event]()
+	br := NewBridge(b)
+	defer br.Close()
+	received := make(chan event, 10)
+	b.Subscribe(func(e event) { received <- e })
+
+	svrSideConns := serverAcceptConnectAt(t, t.Name(), br.OnMessage, br.OnClose, nil)
+	senderMsgs, senderMsgHandler := getMessageStreamWithHandler(nil)
+	sender := clientConnectToServerAt(t, t.Name(), senderMsgHandler, nil, nil)
+	otherMsgs, otherMsgHandler := getMessageStreamWithHandler(nil)
+	_ = clientConnectToServerAt(t, t.Name(), otherMsgHandler, nil, nil)
+	for i := 0; i < 2; i++ {
+		if _, err := br.Attach(waitForConnectionOrFail(t, svrSideConns, 100*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sender.Send(websocket.TextMessage, []byte(`{"Topic": "a", "N": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-received:
+		if e != (event{"a", 1}) {
+			t.Fatalf("unexpected message %v", e)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("message was not published on the bus")
+	}
+	if msg := waitForMessageOrFail(t, otherMsgs, 100*time.Millisecond); string(msg.data) != `{"Topic":"a","N":1}` {
+		t.Fatalf("unexpected message %s", msg.data)
+	}
+	select {
+	case msg := <-senderMsgs:
+		t.Fatalf("message was echoed to its sender: %s", msg.data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBridgeBidirectional(t *testing.T) {
+	svrBus, clientBus := bus.NewBus[event](), bus.NewBus[event]()
+	svrBridge, clientBridge := NewBridge(svrBus), NewBridge(clientBus)
+	defer svrBridge.Close()
+	defer clientBridge.Close()
+	var svrCount, clientCount atomic.Int32
+	svrBus.Subscribe(func(event) { svrCount.Add(1) })
+	clientBus.Subscribe(func(event) { clientCount.Add(1) })
+
+	svrSideConns := serverAcceptConnectAt(t, t.Name(), svrBridge.OnMessage, svrBridge.OnClose, nil)
+	clientConn := clientConnectToServerAt(t, t.Name(), clientBridge.OnMessage, clientBridge.OnClose, nil)
+	if _, err := svrBridge.Attach(waitForConnectionOrFail(t, svrSideConns, 100*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientBridge.Attach(clientConn); err != nil {
+		t.Fatal(err)
+	}
+
+	svrBus.Publish(event{"a", 1})
+	clientBus.Publish(event{"b", 2})
+	time.Sleep(100 * time.Millisecond)
+	if svrCount.Load() != 2 || clientCount.Load() != 2 {
+		t.Fatalf("expected every bus to see both messages once, got %d and %d", svrCount.Load(), clientCount.Load())
+	}
+}
+
+func TestBridgeSlowPeerDropsMessages(t *testing.T) {
+	b := bus.NewBus[int]()
+	br := NewBridge(b)
+	defer br.Close()
+	conn := newBlockingConnection()
+	s, err := br.Attach(conn, WithPeerQueue[int](1, bus.DropNewest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		b.Publish(i) // must not block
+	}
+	close(conn.release)
+	time.Sleep(20 * time.Millisecond)
+	if s.Dropped() < 3 {
+		t.Fatalf("expected at least 3 dropped messages, got %d", s.Dropped())
+	}
+	if sent := conn.sentMessages(); len(sent) != 5-int(s.Dropped()) || sent[0] != "0" {
+		t.Fatalf("unexpected messages sent: %v", sent)
+	}
+}
+
+func TestBridgeSlowPeerIsDisconnected(t *testing.T) {
+	b := bus.NewBus[int]()
+	br := NewBridge(b)
+	defer br.Close()
+	conn := newBlockingConnection()
+	if _, err := br.Attach(conn, WithPeerQueue[int](1, bus.Disconnect)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		b.Publish(i)
+	}
+	if !conn.isClosed() {
+		t.Fatal("expected slow peer to be disconnected")
+	}
+}
+
+func TestBridgePausedPeerSkipsMessages(t *testing.T) {
+	b := bus.NewBus[int]()
+	br := NewBridge(b)
+	defer br.Close()
+	conn := newBlockingConnection()
+	close(conn.release)
+	s, err := br.Attach(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pause()
+	b.Publish(1)
+	s.Resume()
+	b.Publish(2)
+	time.Sleep(20 * time.Millisecond)
+	if sent := conn.sentMessages(); len(sent) != 1 || sent[0] != "2" {
+		t.Fatalf("expected only the message published after Resume, got %v", sent)
+	}
+	if stats := s.Stats(); stats.Delivered != 1 || stats.Skipped != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	s.Unsubscribe()
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("expected Done to be closed after Unsubscribe")
+	}
+}
+
+func TestBridgeDoesNotEchoInterceptedMessages(t *testing.T) {
+	b := bus.NewBus(bus.WithPublishInterceptors(func(e event, next func(event)) {
+		e.N += 10
+		next(e)
+	}))
+	br := NewBridge(b)
+	defer br.Close()
+	sender, other := newBlockingConnection(), newBlockingConnection()
+	close(sender.release)
+	close(other.release)
+	for _, conn := range []Connection{sender, other} {
+		if _, err := br.Attach(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	br.OnMessage(sender, websocket.TextMessage, []byte(`{"Topic":"a","N":1}`))
+	b.Publish(event{"a", 1})
+	time.Sleep(20 * time.Millisecond)
+	if sent := sender.sentMessages(); len(sent) != 1 || sent[0] != `{"Topic":"a","N":11}` {
+		t.Fatalf("expected only the local message to be sent to the sender, got %v", sent)
+	}
+	if sent := other.sentMessages(); len(sent) != 2 {
+		t.Fatalf("expected both messages to be sent to the other peer, got %v", sent)
+	}
+}
+
+func TestBridgeRequiresContextBus(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewBridge to panic for a bus that does not pass contexts on")
+		}
+	}()
+	NewBridge(bus.NewReplayBus[event](1, 0))
+}
+
+func TestBridgeAttachErrors(t *testing.T) {
+	br := NewBridge(bus.NewBus[int]())
+	if _, err := br.Attach(newBlockingConnection(), WithPeerTopics[int]("a..b")); !errors.Is(err, bus.ErrInvalidPattern) {
+		t.Fatalf("expected ErrInvalidPattern, got %v", err)
+	}
+	br.Close()
+	if _, err := br.Attach(newBlockingConnection()); !errors.Is(err, ErrBridgeClosed) {
+		t.Fatalf("expected ErrBridgeClosed, got %v", err)
+	}
+}
+
+// blockingConnection is a Connection whose Send blocks until release is closed.
+type blockingConnection struct {
+	mtx     *sync.Mutex
+	sent    []string
+	closed  bool
+	release chan struct{}
+}
+
+func newBlockingConnection() *blockingConnection {
+	return &blockingConnection{mtx: &sync.Mutex{}, release: make(chan struct{})}
+}
+
+func (c *blockingConnection) Send(_ int, data []byte) error {
+	<-c.release
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.sent = append(c.sent, string(data))
+	return nil
+}
+
+func (c *blockingConnection) Conn() *websocket.Conn {
+	return nil
+}
+
+func (c *blockingConnection) Close() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.closed = true
+}
+
+func (c *blockingConnection) String() string {
+	return "blocking"
+}
+
+func (c *blockingConnection) sentMessages() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]string(nil), c.sent...)
+}
+
+func (c *blockingConnection) isClosed() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.closed
+}